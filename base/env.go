@@ -21,7 +21,10 @@ type Env struct {
 	TIKTOK_CLIENT_KEY    string `validate:"required"`
 	TIKTOK_CLIENT_SECRET string `validate:"required"`
 
-	ELEVENLABS_API_KEY string `validate:"required"`
+	DUBBING_PROVIDER   string `validate:"oneof=elevenlabs fake"`
+	ELEVENLABS_API_KEY string `validate:"required_if=DUBBING_PROVIDER elevenlabs"`
+	// optional, polling is the only way to track dubbings without it
+	ELEVENLABS_WEBHOOK_SECRET string
 
 	GLITCHTIP_DSN string `validate:"required"`
 }
@@ -33,16 +36,18 @@ func LoadEnv() *Env {
 	}
 
 	env := Env{
-		DOMAIN:               os.Getenv("DOMAIN"),
-		FRONTEND_DOMAIN:      os.Getenv("FRONTEND_DOMAIN"),
-		IS_PROD:              strToBool(os.Getenv("IS_PROD")),
-		STRIPE_PUBLIC_KEY:    os.Getenv("STRIPE_PUBLIC_KEY"),
-		STRIPE_PRIVATE_KEY:   os.Getenv("STRIPE_PRIVATE_KEY"),
-		STRIPE_WEBHOOK_KEY:   os.Getenv("STRIPE_WEBHOOK_KEY"),
-		TIKTOK_CLIENT_KEY:    os.Getenv("TIKTOK_CLIENT_KEY"),
-		TIKTOK_CLIENT_SECRET: os.Getenv("TIKTOK_CLIENT_SECRET"),
-		ELEVENLABS_API_KEY:   os.Getenv("ELEVENLABS_API_KEY"),
-		GLITCHTIP_DSN:        os.Getenv("GLITCHTIP_DSN"),
+		DOMAIN:                    os.Getenv("DOMAIN"),
+		FRONTEND_DOMAIN:           os.Getenv("FRONTEND_DOMAIN"),
+		IS_PROD:                   strToBool(os.Getenv("IS_PROD")),
+		STRIPE_PUBLIC_KEY:         os.Getenv("STRIPE_PUBLIC_KEY"),
+		STRIPE_PRIVATE_KEY:        os.Getenv("STRIPE_PRIVATE_KEY"),
+		STRIPE_WEBHOOK_KEY:        os.Getenv("STRIPE_WEBHOOK_KEY"),
+		TIKTOK_CLIENT_KEY:         os.Getenv("TIKTOK_CLIENT_KEY"),
+		TIKTOK_CLIENT_SECRET:      os.Getenv("TIKTOK_CLIENT_SECRET"),
+		DUBBING_PROVIDER:          strOrDefault(os.Getenv("DUBBING_PROVIDER"), "elevenlabs"),
+		ELEVENLABS_API_KEY:        os.Getenv("ELEVENLABS_API_KEY"),
+		ELEVENLABS_WEBHOOK_SECRET: os.Getenv("ELEVENLABS_WEBHOOK_SECRET"),
+		GLITCHTIP_DSN:             os.Getenv("GLITCHTIP_DSN"),
 	}
 
 	validate := validator.New(validator.WithRequiredStructEnabled())
@@ -65,3 +70,10 @@ func strToBool(s string) bool {
 	log.Fatal("Error .env: strToBool failed. string: ", s)
 	return false
 }
+
+func strOrDefault(s string, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
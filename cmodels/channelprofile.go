@@ -0,0 +1,93 @@
+package cmodels
+
+import (
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// ChannelProfile is the public profile of a channel's account, synced from
+// the platform. The struct is embedded in Channel.
+type ChannelProfile struct {
+	DisplayName     string         `db:"display_name" json:"display_name"`
+	Username        string         `db:"username" json:"username"`
+	AvatarURL       string         `db:"avatar_url" json:"avatar_url"`
+	BioDescription  string         `db:"bio_description" json:"bio_description"`
+	ProfileURL      string         `db:"profile_url" json:"profile_url"`
+	IsVerified      bool           `db:"is_verified" json:"is_verified"`
+	FollowerCount   int64          `db:"follower_count" json:"follower_count"`
+	FollowingCount  int64          `db:"following_count" json:"following_count"`
+	LikesCount      int64          `db:"likes_count" json:"likes_count"`
+	VideoCount      int64          `db:"video_count" json:"video_count"`
+	ProfileSyncedIn types.DateTime `db:"profile_synced_in" json:"profile_synced_in"`
+}
+
+func channelProfileSchemaFields() []*schema.SchemaField {
+	return []*schema.SchemaField{
+		{
+			Name:     "display_name",
+			Type:     schema.FieldTypeText,
+			Required: false,
+			Options:  &schema.TextOptions{},
+		},
+		{
+			Name:     "username",
+			Type:     schema.FieldTypeText,
+			Required: false,
+			Options:  &schema.TextOptions{},
+		},
+		{
+			Name:     "avatar_url",
+			Type:     schema.FieldTypeUrl,
+			Required: false,
+			Options:  &schema.UrlOptions{},
+		},
+		{
+			Name:     "bio_description",
+			Type:     schema.FieldTypeText,
+			Required: false,
+			Options:  &schema.TextOptions{},
+		},
+		{
+			Name:     "profile_url",
+			Type:     schema.FieldTypeUrl,
+			Required: false,
+			Options:  &schema.UrlOptions{},
+		},
+		{
+			Name:     "is_verified",
+			Type:     schema.FieldTypeBool,
+			Required: false,
+			Options:  &schema.BoolOptions{},
+		},
+		{
+			Name:     "follower_count",
+			Type:     schema.FieldTypeNumber,
+			Required: false,
+			Options:  &schema.NumberOptions{NoDecimal: true},
+		},
+		{
+			Name:     "following_count",
+			Type:     schema.FieldTypeNumber,
+			Required: false,
+			Options:  &schema.NumberOptions{NoDecimal: true},
+		},
+		{
+			Name:     "likes_count",
+			Type:     schema.FieldTypeNumber,
+			Required: false,
+			Options:  &schema.NumberOptions{NoDecimal: true},
+		},
+		{
+			Name:     "video_count",
+			Type:     schema.FieldTypeNumber,
+			Required: false,
+			Options:  &schema.NumberOptions{NoDecimal: true},
+		},
+		{
+			Name:     "profile_synced_in",
+			Type:     schema.FieldTypeDate,
+			Required: false,
+			Options:  &schema.DateOptions{},
+		},
+	}
+}
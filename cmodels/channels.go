@@ -1,9 +1,13 @@
 package cmodels
 
 import (
+	"basedpocket/utils"
 	"fmt"
 	"log"
 
+	"github.com/getsentry/sentry-go"
+	"github.com/pocketbase/dbx"
+
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/models"
 	"github.com/pocketbase/pocketbase/models/schema"
@@ -20,17 +24,59 @@ type Channel struct {
 	Platform        string          `db:"platform" json:"platform"`
 	Language        string          `db:"language" json:"language"`
 	AccessExpiresIn *types.DateTime `db:"access_expires_in" json:"access_expires_in"`
+	ExternalID      string          `db:"external_id" json:"external_id"`
+	AutoPublish     bool            `db:"auto_publish" json:"auto_publish"`
+	NeedsReauth     bool            `db:"needs_reauth" json:"needs_reauth"`
+	ChannelProfile
 }
 type FindChannelParams struct {
-	Id       string `db:"id"`
-	User     string `db:"user"`
-	Platform string `db:"platform"`
+	Id         string `db:"id"`
+	User       string `db:"user"`
+	Platform   string `db:"platform"`
+	ExternalID string `db:"external_id"`
 }
 
 func (m *Channel) TableName() string {
 	return channels // the name of your collection
 }
 
+func (m *Channel) FindChannel(app core.App, params *FindChannelParams) *utils.CError {
+	return FindFirstByParams(app, m, params)
+}
+
+func (m *Channel) SaveChannel(app core.App) *utils.CError {
+	return Save(app, m)
+}
+
+func FindChannels(app core.App, params *FindChannelParams) ([]*Channel, *utils.CError) {
+	found := []*Channel{}
+	err := app.Dao().ModelQuery(&Channel{}).
+		AndWhere(paramsToExp(params)).
+		OrderBy("created ASC").
+		All(&found)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return found, nil
+}
+
+// FindConnectedChannels returns the channels on platforms named name that
+// don't wait for reauthorization, least recently synced first.
+func FindConnectedChannels(app core.App, name PlatformName) ([]*Channel, *utils.CError) {
+	found := []*Channel{}
+	err := app.Dao().ModelQuery(&Channel{}).
+		AndWhere(dbx.NewExp(fmt.Sprintf("platform IN (SELECT id FROM %s WHERE name = {:name})", platforms), dbx.Params{"name": string(name)})).
+		AndWhere(dbx.HashExp{"needs_reauth": false}).
+		OrderBy("profile_synced_in ASC").
+		All(&found)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return found, nil
+}
+
 // ===================================
 
 func createChannelCollection(app core.App) {
@@ -38,9 +84,6 @@ func createChannelCollection(app core.App) {
 	collectionName := channels
 
 	existingCollection, _ := app.Dao().FindCollectionByNameOrId(collectionName)
-	if existingCollection != nil {
-		return
-	}
 
 	users, err := app.Dao().FindCollectionByNameOrId(users)
 	if err != nil {
@@ -93,13 +136,35 @@ func createChannelCollection(app core.App) {
 				Required: false,
 				Options:  &schema.DateOptions{},
 			},
+			&schema.SchemaField{
+				Name:     "external_id",
+				Type:     schema.FieldTypeText,
+				Required: false,
+				Options:  &schema.TextOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "auto_publish",
+				Type:     schema.FieldTypeBool,
+				Required: false,
+				Options:  &schema.BoolOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "needs_reauth",
+				Type:     schema.FieldTypeBool,
+				Required: false,
+				Options:  &schema.BoolOptions{},
+			},
 		),
 		Indexes: types.JsonArray[string]{
-			fmt.Sprintf("CREATE UNIQUE INDEX idx_user ON %s (user)", collectionName),
+			fmt.Sprintf("CREATE UNIQUE INDEX idx_%s_user_platform_external_id ON %s (user, platform, external_id)", collectionName, collectionName),
 		},
 	}
 
-	if err := app.Dao().SaveCollection(collection); err != nil {
+	for _, field := range channelProfileSchemaFields() {
+		collection.Schema.AddField(field)
+	}
+
+	if err := upsertCollection(app, existingCollection, collection); err != nil {
 		log.Fatalf("%s collection failed: %+v", collectionName, err)
 	}
 }
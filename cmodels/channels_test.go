@@ -0,0 +1,44 @@
+// PocketBase v0.22 can't decode collection schemas with the json v2
+// experiment, tests that need a database only build without it.
+
+//go:build !goexperiment.jsonv2
+
+package cmodels
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func TestChannelsAreUniquePerUserPlatformAndAccount(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+	CreateCollections(app)
+
+	cases := []struct {
+		name      string
+		channel   *Channel
+		duplicate bool
+	}{
+		{name: "first channel", channel: &Channel{User: "test_user", Platform: string(TikTokPlatform), ExternalID: "open_1"}},
+		{name: "second account of the user", channel: &Channel{User: "test_user", Platform: string(TikTokPlatform), ExternalID: "open_2"}},
+		{name: "same account on another platform", channel: &Channel{User: "test_user", Platform: string(YoutubePlatform), ExternalID: "open_1"}},
+		{name: "same account of another user", channel: &Channel{User: "other_user", Platform: string(TikTokPlatform), ExternalID: "open_1"}},
+		{name: "same account twice", channel: &Channel{User: "test_user", Platform: string(TikTokPlatform), ExternalID: "open_1"}, duplicate: true},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			expiresIn := types.NowDateTime()
+			test.channel.AccessExpiresIn = &expiresIn
+			err := test.channel.SaveChannel(app)
+			if test.duplicate != (err != nil) {
+				t.Fatalf("duplicate %t, got %+v", test.duplicate, err)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package cmodels
 
 import (
+	"basedpocket/utils"
 	"fmt"
 	"log"
 
@@ -32,6 +33,18 @@ func (m *Customer) TableName() string {
 	return customers // the name of your collection
 }
 
+func (m *Customer) FindCustomer(app core.App, params *FindCustomerParams) *utils.CError {
+	return FindFirstByParams(app, m, params)
+}
+
+func (m *Customer) SaveCustomer(app core.App) *utils.CError {
+	return Save(app, m)
+}
+
+func (m *Customer) DeleteCustomer(app core.App) *utils.CError {
+	return Delete(app, m)
+}
+
 // =======================================
 
 func createCustomersCollection(app core.App) {
@@ -39,9 +52,6 @@ func createCustomersCollection(app core.App) {
 	collectionName := customers
 
 	existingCollection, _ := app.Dao().FindCollectionByNameOrId(collectionName)
-	if existingCollection != nil {
-		return
-	}
 
 	users, err := app.Dao().FindCollectionByNameOrId(users)
 	if err != nil {
@@ -91,7 +101,7 @@ func createCustomersCollection(app core.App) {
 		},
 	}
 
-	if err := app.Dao().SaveCollection(collection); err != nil {
+	if err := upsertCollection(app, existingCollection, collection); err != nil {
 		log.Fatalf("%s collection failed: %+v", collectionName, err)
 	}
 }
@@ -0,0 +1,85 @@
+package cmodels
+
+import (
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+// DubbingOptions are the per-job knobs forwarded to the dubbing provider.
+// The struct is embedded in Dubjob and DubRequest, so they share columns.
+type DubbingOptions struct {
+	SourceLanguage      string `db:"source_language" json:"source_language" validate:"omitempty,language|eq=auto"`
+	NumSpeakers         int    `db:"num_speakers" json:"num_speakers" validate:"min=0,max=32"`
+	Watermark           bool   `db:"watermark" json:"watermark"`
+	StartTime           int    `db:"start_time" json:"start_time" validate:"min=0"`
+	EndTime             int    `db:"end_time" json:"end_time" validate:"omitempty,gtfield=StartTime"`
+	HighestResolution   bool   `db:"highest_resolution" json:"highest_resolution"`
+	DropBackgroundAudio bool   `db:"drop_background_audio" json:"drop_background_audio"`
+}
+
+// IsClipped reports whether only part of the source is to be dubbed. A
+// StartTime without an EndTime dubs from StartTime to the end.
+func (o DubbingOptions) IsClipped() bool {
+	return o.StartTime > 0 || o.EndTime > 0
+}
+
+// BilledSeconds is the part of a source of durationSec seconds that is dubbed.
+func (o DubbingOptions) BilledSeconds(durationSec int) int {
+	if !o.IsClipped() {
+		return durationSec
+	}
+	end := o.EndTime
+	if end == 0 || end > durationSec {
+		end = durationSec
+	}
+	if end <= o.StartTime {
+		return 0
+	}
+	return end - o.StartTime
+}
+
+func dubbingOptionsSchemaFields() []*schema.SchemaField {
+	return []*schema.SchemaField{
+		{
+			Name:     "source_language",
+			Type:     schema.FieldTypeText,
+			Required: false,
+			Options:  &schema.TextOptions{},
+		},
+		{
+			Name:     "num_speakers",
+			Type:     schema.FieldTypeNumber,
+			Required: false,
+			Options:  &schema.NumberOptions{NoDecimal: true},
+		},
+		{
+			Name:     "watermark",
+			Type:     schema.FieldTypeBool,
+			Required: false,
+			Options:  &schema.BoolOptions{},
+		},
+		{
+			Name:     "start_time",
+			Type:     schema.FieldTypeNumber,
+			Required: false,
+			Options:  &schema.NumberOptions{NoDecimal: true},
+		},
+		{
+			Name:     "end_time",
+			Type:     schema.FieldTypeNumber,
+			Required: false,
+			Options:  &schema.NumberOptions{NoDecimal: true},
+		},
+		{
+			Name:     "highest_resolution",
+			Type:     schema.FieldTypeBool,
+			Required: false,
+			Options:  &schema.BoolOptions{},
+		},
+		{
+			Name:     "drop_background_audio",
+			Type:     schema.FieldTypeBool,
+			Required: false,
+			Options:  &schema.BoolOptions{},
+		},
+	}
+}
@@ -0,0 +1,27 @@
+package cmodels
+
+import "testing"
+
+func TestBilledSeconds(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     DubbingOptions
+		durationSec int
+		expected    int
+	}{
+		{"whole source", DubbingOptions{}, 120, 120},
+		{"clip", DubbingOptions{StartTime: 10, EndTime: 40}, 120, 30},
+		{"clip from the start", DubbingOptions{EndTime: 40}, 120, 40},
+		{"start only dubs to the end", DubbingOptions{StartTime: 100}, 120, 20},
+		{"end past the source", DubbingOptions{StartTime: 100, EndTime: 500}, 120, 20},
+		{"start past the source", DubbingOptions{StartTime: 200}, 120, 0},
+		{"empty source", DubbingOptions{}, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if billed := test.options.BilledSeconds(test.durationSec); billed != test.expected {
+				t.Errorf("billed %d, expected %d", billed, test.expected)
+			}
+		})
+	}
+}
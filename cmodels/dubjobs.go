@@ -1,34 +1,156 @@
 package cmodels
 
 import (
+	"basedpocket/utils"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
+	"github.com/getsentry/sentry-go"
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
 	"github.com/pocketbase/pocketbase/models"
 	"github.com/pocketbase/pocketbase/models/schema"
 	"github.com/pocketbase/pocketbase/tools/types"
 )
 
+type DubjobStatus string
+
+const DubjobQueued DubjobStatus = "queued"
+const DubjobSubmitted DubjobStatus = "submitted"
+const DubjobDubbing DubjobStatus = "dubbing"
+const DubjobDubbed DubjobStatus = "dubbed"
+const DubjobPublishing DubjobStatus = "publishing"
+const DubjobPublished DubjobStatus = "published"
+const DubjobFailed DubjobStatus = "failed"
+const DubjobCancelled DubjobStatus = "cancelled"
+const DubjobDeadLetter DubjobStatus = "dead_letter"
+
+// DefaultDubjobMaxAttempts is used when a dubjob has no max_attempts set.
+const DefaultDubjobMaxAttempts int = 5
+
+// allowedDubjobTransitions lists every legal move of the dubjob lifecycle.
+// A status that is missing as a key is terminal. A failed publish goes back
+// to dubbed: the dub itself is fine and must not be retried. A dub that is
+// done can't be cancelled any more, only its pending publish can.
+var allowedDubjobTransitions = map[DubjobStatus][]DubjobStatus{
+	DubjobQueued:     {DubjobSubmitted, DubjobFailed, DubjobCancelled},
+	DubjobSubmitted:  {DubjobDubbing, DubjobDubbed, DubjobFailed, DubjobCancelled},
+	DubjobDubbing:    {DubjobDubbed, DubjobFailed, DubjobCancelled},
+	DubjobDubbed:     {DubjobPublishing},
+	DubjobPublishing: {DubjobPublished, DubjobDubbed},
+	DubjobFailed:     {DubjobQueued, DubjobDeadLetter, DubjobCancelled},
+	DubjobDeadLetter: {DubjobQueued, DubjobCancelled},
+}
+
+func CanTransitionDubjob(from DubjobStatus, to DubjobStatus) bool {
+	if from == "" {
+		from = DubjobQueued
+	}
+	for _, next := range allowedDubjobTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (s DubjobStatus) IsTerminal() bool {
+	return len(allowedDubjobTransitions[s]) == 0
+}
+
+// IsSucceeded reports whether the dubbing itself is done, whatever
+// happens to the publishing step afterwards.
+func (s DubjobStatus) IsSucceeded() bool {
+	return s == DubjobDubbed || s == DubjobPublishing || s == DubjobPublished
+}
+
+// IsFailed reports whether the dubjob gave up for good. A failed dubjob is
+// not included since it is still waiting for a retry.
+func (s DubjobStatus) IsFailed() bool {
+	return s == DubjobDeadLetter || s == DubjobCancelled
+}
+
+// =========================================
+// =========================================
+
 const dubjobs string = "dubjobs"
 
+// DubjobMaxFileSize caps the size of files stored on a dubjob (bytes).
+const DubjobMaxFileSize int = 5 << 30
+
+// TranscriptMaxSize caps the size of a stored transcript (bytes).
+const TranscriptMaxSize int = 10 << 20
+
+// SourceFileMaxSize caps the size of an uploaded source (bytes).
+const SourceFileMaxSize int = 1 << 30
+
+// SourceFileMimeTypes are the media types accepted as an uploaded source.
+var SourceFileMimeTypes = []string{
+	"video/mp4",
+	"video/quicktime",
+	"video/webm",
+	"video/x-matroska",
+	"audio/mpeg",
+	"audio/mp4",
+	"audio/wav",
+	"audio/x-wav",
+	"audio/flac",
+	"audio/ogg",
+}
+
 var _ models.Model = (*Dubjob)(nil)
 
 type Dubjob struct {
 	models.BaseModel
-	User            string          `db:"user" json:"user"`
-	Channel         string          `db:"channel" json:"channel"`
-	SourceURL       string          `db:"source_url" json:"source_url"`
-	TargetLanguage  string          `db:"target_language" json:"target_language"`
-	ExternalID      string          `db:"external_id" json:"external_id"`
-	ExpectedReadyIn *types.DateTime `db:"expected_ready_in" json:"expected_ready_in"`
-	OutputURL       string          `db:"output_url" json:"output_url"`
-	FinishedIn      *types.DateTime `db:"finished_in" json:"finished_in"`
+	User            string         `db:"user" json:"user"`
+	Channel         string         `db:"channel" json:"channel"`
+	DubRequest      string         `db:"dub_request" json:"dub_request"`
+	Video           string         `db:"video" json:"video"`
+	SourceURL       string         `db:"source_url" json:"source_url"`
+	SourceFile      string         `db:"source_file" json:"source_file"`
+	TargetLanguage  string         `db:"target_language" json:"target_language"`
+	DurationSec     int            `db:"duration_sec" json:"duration_sec"`
+	Provider        string         `db:"provider" json:"provider"`
+	ExternalID      string         `db:"external_id" json:"external_id"`
+	ExpectedReadyIn types.DateTime `db:"expected_ready_in" json:"expected_ready_in"`
+	OutputURL       string         `db:"output_url" json:"output_url"`
+	OutputFile      string         `db:"output_file" json:"output_file"`
+	OutputChecksum  string         `db:"output_checksum" json:"output_checksum"`
+	OutputSize      int64          `db:"output_size" json:"output_size"`
+	TranscriptSrt   string         `db:"transcript_srt" json:"transcript_srt"`
+	TranscriptVtt   string         `db:"transcript_vtt" json:"transcript_vtt"`
+	FinishedIn      types.DateTime `db:"finished_in" json:"finished_in"`
+	ErrorMessage    string         `db:"error_message" json:"error_message"`
+	Status          DubjobStatus   `db:"status" json:"status"`
+	StatusReason    string         `db:"status_reason" json:"status_reason"`
+	StatusChangedIn types.DateTime `db:"status_changed_in" json:"status_changed_in"`
+	Attempts        int            `db:"attempts" json:"attempts"`
+	MaxAttempts     int            `db:"max_attempts" json:"max_attempts"`
+	NextAttemptIn   types.DateTime `db:"next_attempt_in" json:"next_attempt_in"`
+	PublishID       string         `db:"publish_id" json:"publish_id"`
+	PostID          string         `db:"post_id" json:"post_id"`
+	PublishError    string         `db:"publish_error" json:"publish_error"`
+	PublishedIn     types.DateTime `db:"published_in" json:"published_in"`
+	CleanedIn       types.DateTime `db:"cleaned_in" json:"cleaned_in"`
+
+	// measured from the stored output, 0 when its format can't be probed
+	OutputDurationSec int `db:"output_duration_sec" json:"output_duration_sec"`
+	// failed posts of the current publish, reset when publishing starts
+	PublishAttempts int `db:"publish_attempts" json:"publish_attempts"`
+	DubbingOptions
+	PublishOptions
 }
 type FindDubjobParams struct {
-	Id         string `db:"id"`
-	User       string `db:"user"`
-	ExternalID string `db:"external_id"`
+	Id         string       `db:"id"`
+	User       string       `db:"user"`
+	Channel    string       `db:"channel"`
+	DubRequest string       `db:"dub_request"`
+	ExternalID string       `db:"external_id"`
+	PublishID  string       `db:"publish_id"`
+	Status     DubjobStatus `db:"status"`
 }
 
 func (m *Dubjob) TableName() string {
@@ -37,14 +159,302 @@ func (m *Dubjob) TableName() string {
 
 // ============================================
 
+func (m *Dubjob) FindDubjob(app core.App, params *FindDubjobParams) *utils.CError {
+	return FindFirstByParams(app, m, params)
+}
+
+// SaveDubjob saves the dubjob's fields. An existing dubjob is only saved
+// while its stored status is still the one it was loaded with, so a save
+// never reverts a transition made in the meantime.
+func (m *Dubjob) SaveDubjob(app core.App) *utils.CError {
+	if m.Status == "" {
+		m.Status = DubjobQueued
+		m.StatusChangedIn = types.NowDateTime()
+	}
+	if m.IsNew() {
+		return Save(app, m)
+	}
+
+	err := app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
+		if err := compareAndSetDubjobStatus(txDao, m.Id, m.Status, m.Status); err != nil {
+			return err
+		}
+		return txDao.Save(m)
+	})
+	if err != nil {
+		return dubjobWriteError(err)
+	}
+	return nil
+}
+
+// Transition moves the dubjob to the given status and saves it together
+// with a dubjob_transitions row, so the full history of a job can be traced.
+// Illegal moves are rejected and nothing is written. The move is a
+// compare-and-set on the stored status: when another writer moved the
+// dubjob first, a conflict is returned and nothing is written either.
+func (m *Dubjob) Transition(app core.App, to DubjobStatus, reason string) *utils.CError {
+	return m.TransitionWithDao(app.Dao(), to, reason)
+}
+
+// TransitionWithDao is Transition for callers that are already inside a
+// transaction and need the move to be rolled back with it.
+func (m *Dubjob) TransitionWithDao(dao *daos.Dao, to DubjobStatus, reason string) *utils.CError {
+	from := m.Status
+	if from == "" {
+		from = DubjobQueued
+	}
+	if !CanTransitionDubjob(from, to) {
+		err := fmt.Errorf("illegal dubjob transition from %s to %s | dubjob: %s", from, to, m.Id)
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: fmt.Sprintf("Dubjob cannot move from %s to %s", from, to), EventID: *eventID, Error: err}
+	}
+
+	previousReason := m.StatusReason
+	previousChangedIn := m.StatusChangedIn
+	m.Status = to
+	m.StatusReason = reason
+	m.StatusChangedIn = types.NowDateTime()
+
+	err := dao.RunInTransaction(func(txDao *daos.Dao) error {
+		if err := compareAndSetDubjobStatus(txDao, m.Id, from, to); err != nil {
+			return err
+		}
+		if err := txDao.Save(m); err != nil {
+			return err
+		}
+		transition := &DubjobTransition{
+			User:       m.User,
+			Dubjob:     m.Id,
+			FromStatus: from,
+			ToStatus:   to,
+			Reason:     reason,
+		}
+		if err := txDao.Save(transition); err != nil {
+			return err
+		}
+		if m.DubRequest != "" {
+			return refreshDubRequest(txDao, m.DubRequest)
+		}
+		return nil
+	})
+	if err != nil {
+		m.Status = from
+		m.StatusReason = previousReason
+		m.StatusChangedIn = previousChangedIn
+		return dubjobWriteError(err)
+	}
+	return nil
+}
+
+// compareAndSetDubjobStatus sets the stored status of the dubjob to to, but
+// only while it still is from. It fails with utils.ErrConflict when the row
+// moved on, which rolls back the surrounding transaction.
+func compareAndSetDubjobStatus(dao *daos.Dao, id string, from DubjobStatus, to DubjobStatus) error {
+	res, err := dao.DB().Update(
+		dubjobs,
+		dbx.Params{"status": string(to)},
+		dbx.HashExp{"id": id, "status": string(from)},
+	).Execute()
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected != 1 {
+		return fmt.Errorf("%w: dubjob %s is no longer %s", utils.ErrConflict, id, from)
+	}
+	return nil
+}
+
+func dubjobWriteError(err error) *utils.CError {
+	if errors.Is(err, utils.ErrConflict) {
+		return &utils.CError{Message: "The dubjob was changed by another request, reload it and try again", Error: err}
+	}
+	eventID := sentry.CaptureException(err)
+	return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+}
+
+// FindDubjobs lists the dubjobs matching params, newest first.
+func FindDubjobs(app core.App, params *FindDubjobParams, limit int, offset int) ([]*Dubjob, *utils.CError) {
+	dubjobs := []*Dubjob{}
+	err := app.Dao().ModelQuery(&Dubjob{}).
+		AndWhere(paramsToExp(params)).
+		OrderBy("created DESC").
+		Limit(int64(limit)).
+		Offset(int64(offset)).
+		All(&dubjobs)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return dubjobs, nil
+}
+
+// FindDueDubjobs returns the dubjobs that are still being dubbed by the
+// provider and whose expected_ready_in is at or before now.
+func FindDueDubjobs(app core.App, now time.Time) ([]*Dubjob, *utils.CError) {
+	nowDate, err := types.ParseDateTime(now)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+
+	dubjobs := []*Dubjob{}
+	err = app.Dao().ModelQuery(&Dubjob{}).
+		AndWhere(dbx.NewExp("external_id != ''")).
+		AndWhere(dbx.In("status", string(DubjobSubmitted), string(DubjobDubbing))).
+		AndWhere(dbx.NewExp("expected_ready_in != '' AND expected_ready_in <= {:now}", dbx.Params{"now": nowDate.String()})).
+		OrderBy("expected_ready_in ASC").
+		All(&dubjobs)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return dubjobs, nil
+}
+
+// FindRetryableDubjobs returns the failed dubjobs whose next attempt is due.
+func FindRetryableDubjobs(app core.App, now time.Time) ([]*Dubjob, *utils.CError) {
+	nowDate, err := types.ParseDateTime(now)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+
+	dubjobs := []*Dubjob{}
+	err = app.Dao().ModelQuery(&Dubjob{}).
+		AndWhere(dbx.HashExp{"status": string(DubjobFailed)}).
+		AndWhere(dbx.NewExp("next_attempt_in != '' AND next_attempt_in <= {:now}", dbx.Params{"now": nowDate.String()})).
+		OrderBy("next_attempt_in ASC").
+		All(&dubjobs)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return dubjobs, nil
+}
+
+// FindDubjobsByStatus returns every dubjob in one of the given statuses,
+// oldest first.
+func FindDubjobsByStatus(app core.App, statuses ...DubjobStatus) ([]*Dubjob, *utils.CError) {
+	values := make([]any, len(statuses))
+	for i, status := range statuses {
+		values[i] = string(status)
+	}
+
+	found := []*Dubjob{}
+	err := app.Dao().ModelQuery(&Dubjob{}).
+		AndWhere(dbx.In("status", values...)).
+		OrderBy("created ASC").
+		All(&found)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return found, nil
+}
+
+// FindQueuedDubjobs returns up to limit queued dubjobs in submission order:
+// owners with a higher Customer.Tier first, then oldest first.
+func FindQueuedDubjobs(app core.App, limit int) ([]*Dubjob, *utils.CError) {
+	queued := []*Dubjob{}
+	err := app.Dao().ModelQuery(&Dubjob{}).
+		LeftJoin(customers, dbx.NewExp(fmt.Sprintf("%s.user = %s.user", customers, dubjobs))).
+		AndWhere(dbx.NewExp(fmt.Sprintf("%s.status = {:status}", dubjobs), dbx.Params{"status": string(DubjobQueued)})).
+		OrderBy(fmt.Sprintf("COALESCE(%s.tier, 0) DESC", customers), fmt.Sprintf("%s.created ASC", dubjobs)).
+		Limit(int64(limit)).
+		All(&queued)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return queued, nil
+}
+
+// CountActiveDubjobs counts the dubjobs that are running at the provider,
+// per user and in total.
+func CountActiveDubjobs(app core.App) (map[string]int, int, *utils.CError) {
+	rows := []struct {
+		User  string `db:"user"`
+		Count int    `db:"count"`
+	}{}
+	err := app.Dao().DB().
+		Select("user", "COUNT(*) AS count").
+		From(dubjobs).
+		Where(dbx.In("status", string(DubjobSubmitted), string(DubjobDubbing))).
+		GroupBy("user").
+		All(&rows)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, 0, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+
+	perUser := map[string]int{}
+	total := 0
+	for _, row := range rows {
+		perUser[row.User] = row.Count
+		total += row.Count
+	}
+	return perUser, total, nil
+}
+
+// FindCleanableDubjobs returns the settled dubjobs whose files were not
+// cleaned up yet and whose last transition is at or before before.
+func FindCleanableDubjobs(app core.App, before time.Time) ([]*Dubjob, *utils.CError) {
+	beforeDate, err := types.ParseDateTime(before)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+
+	found := []*Dubjob{}
+	err = app.Dao().ModelQuery(&Dubjob{}).
+		AndWhere(dbx.In("status", string(DubjobDubbed), string(DubjobPublished), string(DubjobCancelled), string(DubjobDeadLetter))).
+		AndWhere(dbx.HashExp{"cleaned_in": ""}).
+		AndWhere(dbx.NewExp("status_changed_in != '' AND status_changed_in <= {:before}", dbx.Params{"before": beforeDate.String()})).
+		OrderBy("status_changed_in ASC").
+		All(&found)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return found, nil
+}
+
+// StoredFiles lists the names of the files stored on the dubjob.
+func (m *Dubjob) StoredFiles() []string {
+	names := []string{}
+	for _, name := range []string{m.SourceFile, m.OutputFile, m.TranscriptSrt, m.TranscriptVtt} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// IsCleaned reports whether the dubjob's files were deleted after its
+// retention. It stays as history only and can't be published, requeued or
+// downloaded from any more.
+func (m *Dubjob) IsCleaned() bool {
+	return !m.CleanedIn.IsZero()
+}
+
+func (m *Dubjob) GetMaxAttempts() int {
+	if m.MaxAttempts <= 0 {
+		return DefaultDubjobMaxAttempts
+	}
+	return m.MaxAttempts
+}
+
+// ============================================
+
 func createDubjobCollection(app core.App) {
 
 	collectionName := dubjobs
 
 	existingCollection, _ := app.Dao().FindCollectionByNameOrId(collectionName)
-	if existingCollection != nil {
-		return
-	}
 
 	users, err := app.Dao().FindCollectionByNameOrId(users)
 	if err != nil {
@@ -56,6 +466,16 @@ func createDubjobCollection(app core.App) {
 		log.Fatalf("channels table not found: %+v", err)
 	}
 
+	dubRequests, err := app.Dao().FindCollectionByNameOrId(dubRequests)
+	if err != nil {
+		log.Fatalf("dub_requests table not found: %+v", err)
+	}
+
+	videos, err := app.Dao().FindCollectionByNameOrId(videos)
+	if err != nil {
+		log.Fatalf("videos table not found: %+v", err)
+	}
+
 	collection := &models.Collection{
 		Name:       collectionName,
 		Type:       models.CollectionTypeBase,
@@ -85,28 +505,70 @@ func createDubjobCollection(app core.App) {
 					CascadeDelete: true,
 				},
 			},
+			&schema.SchemaField{
+				Name:     "dub_request",
+				Type:     schema.FieldTypeRelation,
+				Required: false,
+				Options: &schema.RelationOptions{
+					MaxSelect:     types.Pointer(1),
+					CollectionId:  dubRequests.Id,
+					CascadeDelete: true,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "video",
+				Type:     schema.FieldTypeRelation,
+				Required: false,
+				Options: &schema.RelationOptions{
+					MaxSelect:     types.Pointer(1),
+					CollectionId:  videos.Id,
+					CascadeDelete: false,
+				},
+			},
 			&schema.SchemaField{
 				Name:     "source_url",
 				Type:     schema.FieldTypeUrl,
-				Required: true,
+				Required: false,
 				Options:  &schema.TextOptions{},
 			},
+			&schema.SchemaField{
+				Name:     "source_file",
+				Type:     schema.FieldTypeFile,
+				Required: false,
+				Options: &schema.FileOptions{
+					MaxSelect: 1,
+					MaxSize:   SourceFileMaxSize,
+					MimeTypes: SourceFileMimeTypes,
+				},
+			},
 			&schema.SchemaField{
 				Name:     "target_language",
 				Type:     schema.FieldTypeText,
 				Required: true,
 				Options:  &schema.TextOptions{},
 			},
+			&schema.SchemaField{
+				Name:     "duration_sec",
+				Type:     schema.FieldTypeNumber,
+				Required: false,
+				Options:  &schema.NumberOptions{NoDecimal: true},
+			},
+			&schema.SchemaField{
+				Name:     "provider",
+				Type:     schema.FieldTypeText,
+				Required: false,
+				Options:  &schema.TextOptions{},
+			},
 			&schema.SchemaField{
 				Name:     "external_id",
 				Type:     schema.FieldTypeText,
-				Required: true,
+				Required: false,
 				Options:  &schema.TextOptions{},
 			},
 			&schema.SchemaField{
 				Name:     "expected_ready_in",
 				Type:     schema.FieldTypeDate,
-				Required: true,
+				Required: false,
 				Options:  &schema.TextOptions{},
 			},
 			&schema.SchemaField{
@@ -115,19 +577,163 @@ func createDubjobCollection(app core.App) {
 				Required: false,
 				Options:  &schema.TextOptions{},
 			},
+			&schema.SchemaField{
+				Name:     "output_file",
+				Type:     schema.FieldTypeFile,
+				Required: false,
+				Options: &schema.FileOptions{
+					MaxSelect: 1,
+					MaxSize:   DubjobMaxFileSize,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "output_checksum",
+				Type:     schema.FieldTypeText,
+				Required: false,
+				Options:  &schema.TextOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "output_size",
+				Type:     schema.FieldTypeNumber,
+				Required: false,
+				Options:  &schema.NumberOptions{NoDecimal: true},
+			},
+			&schema.SchemaField{
+				Name:     "output_duration_sec",
+				Type:     schema.FieldTypeNumber,
+				Required: false,
+				Options:  &schema.NumberOptions{NoDecimal: true},
+			},
+			&schema.SchemaField{
+				Name:     "transcript_srt",
+				Type:     schema.FieldTypeFile,
+				Required: false,
+				Options: &schema.FileOptions{
+					MaxSelect: 1,
+					MaxSize:   TranscriptMaxSize,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "transcript_vtt",
+				Type:     schema.FieldTypeFile,
+				Required: false,
+				Options: &schema.FileOptions{
+					MaxSelect: 1,
+					MaxSize:   TranscriptMaxSize,
+				},
+			},
 			&schema.SchemaField{
 				Name:     "finished_in",
 				Type:     schema.FieldTypeDate,
 				Required: false,
 				Options:  &schema.TextOptions{},
 			},
+			&schema.SchemaField{
+				Name:     "error_message",
+				Type:     schema.FieldTypeText,
+				Required: false,
+				Options:  &schema.TextOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "status",
+				Type:     schema.FieldTypeSelect,
+				Required: true,
+				Options: &schema.SelectOptions{
+					MaxSelect: 1,
+					Values: []string{
+						string(DubjobQueued),
+						string(DubjobSubmitted),
+						string(DubjobDubbing),
+						string(DubjobDubbed),
+						string(DubjobPublishing),
+						string(DubjobPublished),
+						string(DubjobFailed),
+						string(DubjobCancelled),
+						string(DubjobDeadLetter),
+					},
+				},
+			},
+			&schema.SchemaField{
+				Name:     "status_reason",
+				Type:     schema.FieldTypeText,
+				Required: false,
+				Options:  &schema.TextOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "status_changed_in",
+				Type:     schema.FieldTypeDate,
+				Required: false,
+				Options:  &schema.DateOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "attempts",
+				Type:     schema.FieldTypeNumber,
+				Required: false,
+				Options:  &schema.NumberOptions{NoDecimal: true},
+			},
+			&schema.SchemaField{
+				Name:     "max_attempts",
+				Type:     schema.FieldTypeNumber,
+				Required: false,
+				Options:  &schema.NumberOptions{NoDecimal: true},
+			},
+			&schema.SchemaField{
+				Name:     "next_attempt_in",
+				Type:     schema.FieldTypeDate,
+				Required: false,
+				Options:  &schema.DateOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "publish_id",
+				Type:     schema.FieldTypeText,
+				Required: false,
+				Options:  &schema.TextOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "post_id",
+				Type:     schema.FieldTypeText,
+				Required: false,
+				Options:  &schema.TextOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "publish_attempts",
+				Type:     schema.FieldTypeNumber,
+				Required: false,
+				Options:  &schema.NumberOptions{NoDecimal: true},
+			},
+			&schema.SchemaField{
+				Name:     "publish_error",
+				Type:     schema.FieldTypeText,
+				Required: false,
+				Options:  &schema.TextOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "published_in",
+				Type:     schema.FieldTypeDate,
+				Required: false,
+				Options:  &schema.DateOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "cleaned_in",
+				Type:     schema.FieldTypeDate,
+				Required: false,
+				Options:  &schema.DateOptions{},
+			},
 		),
 		Indexes: types.JsonArray[string]{
-			fmt.Sprintf("CREATE UNIQUE INDEX idx_user ON %s (user)", collectionName),
+			fmt.Sprintf("CREATE INDEX idx_%s_user ON %s (user)", collectionName, collectionName),
+			fmt.Sprintf("CREATE UNIQUE INDEX idx_%s_dub_request ON %s (dub_request, target_language) WHERE dub_request != ''", collectionName, collectionName),
 		},
 	}
 
-	if err := app.Dao().SaveCollection(collection); err != nil {
+	for _, field := range dubbingOptionsSchemaFields() {
+		collection.Schema.AddField(field)
+	}
+	for _, field := range publishOptionsSchemaFields() {
+		collection.Schema.AddField(field)
+	}
+
+	if err := upsertCollection(app, existingCollection, collection); err != nil {
 		log.Fatalf("%s collection failed: %+v", collectionName, err)
 	}
 }
@@ -0,0 +1,50 @@
+package cmodels
+
+import "testing"
+
+func TestCanTransitionDubjob(t *testing.T) {
+	tests := []struct {
+		from     DubjobStatus
+		to       DubjobStatus
+		expected bool
+	}{
+		{"", DubjobSubmitted, true},
+		{DubjobQueued, DubjobSubmitted, true},
+		{DubjobQueued, DubjobDubbed, false},
+		{DubjobSubmitted, DubjobDubbing, true},
+		{DubjobSubmitted, DubjobDubbed, true},
+		{DubjobDubbing, DubjobDubbed, true},
+		{DubjobDubbing, DubjobQueued, false},
+		{DubjobDubbed, DubjobPublishing, true},
+		{DubjobDubbed, DubjobCancelled, false},
+		{DubjobPublishing, DubjobPublished, true},
+		{DubjobPublishing, DubjobDubbed, true},
+		{DubjobPublishing, DubjobCancelled, false},
+		{DubjobFailed, DubjobQueued, true},
+		{DubjobFailed, DubjobDeadLetter, true},
+		{DubjobDeadLetter, DubjobQueued, true},
+		{DubjobDeadLetter, DubjobCancelled, true},
+		{DubjobPublished, DubjobDubbed, false},
+		{DubjobCancelled, DubjobQueued, false},
+	}
+	for _, test := range tests {
+		t.Run(string(test.from)+"->"+string(test.to), func(t *testing.T) {
+			if allowed := CanTransitionDubjob(test.from, test.to); allowed != test.expected {
+				t.Errorf("allowed %t, expected %t", allowed, test.expected)
+			}
+		})
+	}
+}
+
+func TestDubjobTerminalStatuses(t *testing.T) {
+	for _, status := range []DubjobStatus{DubjobPublished, DubjobCancelled} {
+		if !status.IsTerminal() {
+			t.Errorf("%s is not terminal", status)
+		}
+	}
+	for _, status := range []DubjobStatus{DubjobQueued, DubjobDubbed, DubjobFailed, DubjobDeadLetter} {
+		if status.IsTerminal() {
+			t.Errorf("%s is terminal", status)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package cmodels
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const dubjobTransitions string = "dubjob_transitions"
+
+var _ models.Model = (*DubjobTransition)(nil)
+
+type DubjobTransition struct {
+	models.BaseModel
+	User       string       `db:"user" json:"user"`
+	Dubjob     string       `db:"dubjob" json:"dubjob"`
+	FromStatus DubjobStatus `db:"from_status" json:"from_status"`
+	ToStatus   DubjobStatus `db:"to_status" json:"to_status"`
+	Reason     string       `db:"reason" json:"reason"`
+}
+
+func (m *DubjobTransition) TableName() string {
+	return dubjobTransitions // the name of your collection
+}
+
+// ============================================
+
+func createDubjobTransitionCollection(app core.App) {
+
+	collectionName := dubjobTransitions
+
+	existingCollection, _ := app.Dao().FindCollectionByNameOrId(collectionName)
+
+	users, err := app.Dao().FindCollectionByNameOrId(users)
+	if err != nil {
+		log.Fatalf("users table not found: %+v", err)
+	}
+
+	dubjobs, err := app.Dao().FindCollectionByNameOrId(dubjobs)
+	if err != nil {
+		log.Fatalf("dubjobs table not found: %+v", err)
+	}
+
+	collection := &models.Collection{
+		Name:       collectionName,
+		Type:       models.CollectionTypeBase,
+		ListRule:   types.Pointer("user.id = @request.auth.id"),
+		ViewRule:   types.Pointer("user.id = @request.auth.id"),
+		CreateRule: nil,
+		UpdateRule: nil,
+		DeleteRule: nil,
+		Schema: schema.NewSchema(
+			&schema.SchemaField{
+				Name:     "user",
+				Type:     schema.FieldTypeRelation,
+				Required: true,
+				Options: &schema.RelationOptions{
+					MaxSelect:     types.Pointer(1),
+					CollectionId:  users.Id,
+					CascadeDelete: true,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "dubjob",
+				Type:     schema.FieldTypeRelation,
+				Required: true,
+				Options: &schema.RelationOptions{
+					MaxSelect:     types.Pointer(1),
+					CollectionId:  dubjobs.Id,
+					CascadeDelete: true,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "from_status",
+				Type:     schema.FieldTypeText,
+				Required: true,
+				Options:  &schema.TextOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "to_status",
+				Type:     schema.FieldTypeText,
+				Required: true,
+				Options:  &schema.TextOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "reason",
+				Type:     schema.FieldTypeText,
+				Required: false,
+				Options:  &schema.TextOptions{},
+			},
+		),
+		Indexes: types.JsonArray[string]{
+			fmt.Sprintf("CREATE INDEX idx_%s_dubjob ON %s (dubjob)", collectionName, collectionName),
+		},
+	}
+
+	if err := upsertCollection(app, existingCollection, collection); err != nil {
+		log.Fatalf("%s collection failed: %+v", collectionName, err)
+	}
+}
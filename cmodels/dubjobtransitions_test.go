@@ -0,0 +1,71 @@
+// PocketBase v0.22 can't decode collection schemas with the json v2
+// experiment, tests that need a database only build without it.
+
+//go:build !goexperiment.jsonv2
+
+package cmodels
+
+import (
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+func TestTransitionWithDao(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+	CreateCollections(app)
+
+	cases := []struct {
+		name     string
+		stored   DubjobStatus
+		loaded   DubjobStatus
+		to       DubjobStatus
+		conflict bool
+		illegal  bool
+	}{
+		{name: "legal move", stored: DubjobQueued, loaded: DubjobQueued, to: DubjobSubmitted},
+		{name: "illegal move", stored: DubjobQueued, loaded: DubjobQueued, to: DubjobPublished, illegal: true},
+		{name: "moved by another writer", stored: DubjobCancelled, loaded: DubjobQueued, to: DubjobSubmitted, conflict: true},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			dubjob := &Dubjob{User: "test_user", Channel: "test_channel", TargetLanguage: "es", DurationSec: 60, Status: test.stored}
+			if err := dubjob.SaveDubjob(app); err != nil {
+				t.Fatal(err)
+			}
+			dubjob.Status = test.loaded
+
+			err := dubjob.TransitionWithDao(app.Dao(), test.to, "test")
+
+			stored := &Dubjob{}
+			if err := stored.FindDubjob(app, &FindDubjobParams{Id: dubjob.Id}); err != nil {
+				t.Fatal(err)
+			}
+			rows := []*DubjobTransition{}
+			if err := app.Dao().ModelQuery(&DubjobTransition{}).AndWhere(dbx.HashExp{"dubjob": dubjob.Id}).All(&rows); err != nil {
+				t.Fatal(err)
+			}
+
+			if test.illegal || test.conflict {
+				if err == nil || err.IsConflict() != test.conflict {
+					t.Fatalf("expected a failed move, got %+v", err)
+				}
+				if dubjob.Status != test.loaded || stored.Status != test.stored || len(rows) != 0 {
+					t.Fatalf("a failed move wrote something: loaded %s, stored %s, %d rows", dubjob.Status, stored.Status, len(rows))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != test.to || len(rows) != 1 || rows[0].FromStatus != test.loaded || rows[0].ToStatus != test.to {
+				t.Fatalf("the move was not stored: %s, %+v", stored.Status, rows)
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package cmodels
+
+import (
+	"basedpocket/utils"
+	"fmt"
+	"log"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+type DubRequestStatus string
+
+const DubRequestProcessing DubRequestStatus = "processing"
+const DubRequestCompleted DubRequestStatus = "completed"
+const DubRequestPartiallyFailed DubRequestStatus = "partially_failed"
+const DubRequestFailed DubRequestStatus = "failed"
+
+// =========================================
+// =========================================
+
+const dubRequests string = "dub_requests"
+
+var _ models.Model = (*DubRequest)(nil)
+
+// DubRequest is the parent of one dubjob per target language of a single
+// source video. Its counters are kept in sync as the children settle. The
+// source is a public URL, an imported video or an uploaded file, which is
+// stored once here and read by every child.
+type DubRequest struct {
+	models.BaseModel
+	User            string                  `db:"user" json:"user"`
+	Channel         string                  `db:"channel" json:"channel"`
+	Video           string                  `db:"video" json:"video"`
+	SourceURL       string                  `db:"source_url" json:"source_url"`
+	SourceFile      string                  `db:"source_file" json:"source_file"`
+	TargetLanguages types.JsonArray[string] `db:"target_languages" json:"target_languages"`
+	DurationSec     int                     `db:"duration_sec" json:"duration_sec"`
+	Status          DubRequestStatus        `db:"status" json:"status"`
+	Total           int                     `db:"total" json:"total"`
+	Succeeded       int                     `db:"succeeded" json:"succeeded"`
+	Failed          int                     `db:"failed" json:"failed"`
+	DubbingOptions
+	PublishOptions
+}
+type FindDubRequestParams struct {
+	Id   string `db:"id"`
+	User string `db:"user"`
+}
+
+func (m *DubRequest) TableName() string {
+	return dubRequests // the name of your collection
+}
+
+// ============================================
+
+func (m *DubRequest) FindDubRequest(app core.App, params *FindDubRequestParams) *utils.CError {
+	return FindFirstByParams(app, m, params)
+}
+
+func (m *DubRequest) SaveDubRequest(app core.App) *utils.CError {
+	return Save(app, m)
+}
+
+// FanOut saves the dub request together with one queued dubjob per target
+// language and returns the children. Nothing is written if any save fails.
+func (m *DubRequest) FanOut(app core.App) ([]*Dubjob, *utils.CError) {
+	return m.FanOutWithDao(app.Dao())
+}
+
+// FanOutWithDao is FanOut for callers that are already inside a transaction.
+func (m *DubRequest) FanOutWithDao(dao *daos.Dao) ([]*Dubjob, *utils.CError) {
+	m.Status = DubRequestProcessing
+	m.Total = len(m.TargetLanguages)
+	m.Succeeded = 0
+	m.Failed = 0
+
+	children := []*Dubjob{}
+	err := dao.RunInTransaction(func(txDao *daos.Dao) error {
+		if err := txDao.Save(m); err != nil {
+			return err
+		}
+		for _, language := range m.TargetLanguages {
+			child := &Dubjob{
+				User:           m.User,
+				Channel:        m.Channel,
+				DubRequest:     m.Id,
+				Video:          m.Video,
+				SourceURL:      m.SourceURL,
+				TargetLanguage: language,
+				DurationSec:    m.DurationSec,
+				DubbingOptions: m.DubbingOptions,
+				PublishOptions: m.PublishOptions,
+				Status:         DubjobQueued,
+				MaxAttempts:    DefaultDubjobMaxAttempts,
+			}
+			child.StatusChangedIn = types.NowDateTime()
+			if err := txDao.Save(child); err != nil {
+				return err
+			}
+			children = append(children, child)
+		}
+		return nil
+	})
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return children, nil
+}
+
+func (m *DubRequest) FindDubjobs(app core.App) ([]*Dubjob, *utils.CError) {
+	children := []*Dubjob{}
+	err := app.Dao().ModelQuery(&Dubjob{}).
+		AndWhere(dbx.HashExp{"dub_request": m.Id}).
+		OrderBy("created ASC").
+		All(&children)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return children, nil
+}
+
+// FindCleanableDubRequests returns the dub requests that still store an
+// uploaded source although every child of theirs was cleaned up.
+func FindCleanableDubRequests(app core.App) ([]*DubRequest, *utils.CError) {
+	found := []*DubRequest{}
+	err := app.Dao().ModelQuery(&DubRequest{}).
+		AndWhere(dbx.NewExp("source_file != ''")).
+		AndWhere(dbx.NewExp(fmt.Sprintf(
+			"NOT EXISTS (SELECT 1 FROM %s WHERE %s.dub_request = %s.id AND %s.cleaned_in = '')",
+			dubjobs, dubjobs, dubRequests, dubjobs,
+		))).
+		All(&found)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return found, nil
+}
+
+// refreshDubRequest recounts the children of a dub request and settles it
+// once every child has either succeeded or failed.
+func refreshDubRequest(dao *daos.Dao, dubRequestID string) error {
+	dubRequest := &DubRequest{}
+	if err := dao.FindById(dubRequest, dubRequestID); err != nil {
+		return err
+	}
+
+	children := []*Dubjob{}
+	if err := dao.ModelQuery(&Dubjob{}).AndWhere(dbx.HashExp{"dub_request": dubRequestID}).All(&children); err != nil {
+		return err
+	}
+
+	dubRequest.Total = len(children)
+	dubRequest.Succeeded = 0
+	dubRequest.Failed = 0
+	for _, child := range children {
+		if child.Status.IsSucceeded() {
+			dubRequest.Succeeded++
+		}
+		if child.Status.IsFailed() {
+			dubRequest.Failed++
+		}
+	}
+
+	switch {
+	case dubRequest.Succeeded+dubRequest.Failed < dubRequest.Total:
+		dubRequest.Status = DubRequestProcessing
+	case dubRequest.Failed == 0:
+		dubRequest.Status = DubRequestCompleted
+	case dubRequest.Succeeded == 0:
+		dubRequest.Status = DubRequestFailed
+	default:
+		dubRequest.Status = DubRequestPartiallyFailed
+	}
+
+	return dao.Save(dubRequest)
+}
+
+// ============================================
+
+func createDubRequestCollection(app core.App) {
+
+	collectionName := dubRequests
+
+	existingCollection, _ := app.Dao().FindCollectionByNameOrId(collectionName)
+
+	users, err := app.Dao().FindCollectionByNameOrId(users)
+	if err != nil {
+		log.Fatalf("users table not found: %+v", err)
+	}
+
+	channels, err := app.Dao().FindCollectionByNameOrId(channels)
+	if err != nil {
+		log.Fatalf("channels table not found: %+v", err)
+	}
+
+	videos, err := app.Dao().FindCollectionByNameOrId(videos)
+	if err != nil {
+		log.Fatalf("videos table not found: %+v", err)
+	}
+
+	collection := &models.Collection{
+		Name:       collectionName,
+		Type:       models.CollectionTypeBase,
+		ListRule:   types.Pointer("user.id = @request.auth.id"),
+		ViewRule:   types.Pointer("user.id = @request.auth.id"),
+		CreateRule: nil,
+		UpdateRule: nil,
+		DeleteRule: nil,
+		Schema: schema.NewSchema(
+			&schema.SchemaField{
+				Name:     "user",
+				Type:     schema.FieldTypeRelation,
+				Required: true,
+				Options: &schema.RelationOptions{
+					MaxSelect:     types.Pointer(1),
+					CollectionId:  users.Id,
+					CascadeDelete: true,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "channel",
+				Type:     schema.FieldTypeRelation,
+				Required: true,
+				Options: &schema.RelationOptions{
+					MaxSelect:     types.Pointer(1),
+					CollectionId:  channels.Id,
+					CascadeDelete: true,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "video",
+				Type:     schema.FieldTypeRelation,
+				Required: false,
+				Options: &schema.RelationOptions{
+					MaxSelect:     types.Pointer(1),
+					CollectionId:  videos.Id,
+					CascadeDelete: false,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "source_url",
+				Type:     schema.FieldTypeUrl,
+				Required: false,
+				Options:  &schema.UrlOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "source_file",
+				Type:     schema.FieldTypeFile,
+				Required: false,
+				Options: &schema.FileOptions{
+					MaxSelect: 1,
+					MaxSize:   SourceFileMaxSize,
+					MimeTypes: SourceFileMimeTypes,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "target_languages",
+				Type:     schema.FieldTypeJson,
+				Required: true,
+				Options:  &schema.JsonOptions{MaxSize: 2000},
+			},
+			&schema.SchemaField{
+				Name:     "duration_sec",
+				Type:     schema.FieldTypeNumber,
+				Required: false,
+				Options:  &schema.NumberOptions{NoDecimal: true},
+			},
+			&schema.SchemaField{
+				Name:     "status",
+				Type:     schema.FieldTypeSelect,
+				Required: true,
+				Options: &schema.SelectOptions{
+					MaxSelect: 1,
+					Values: []string{
+						string(DubRequestProcessing),
+						string(DubRequestCompleted),
+						string(DubRequestPartiallyFailed),
+						string(DubRequestFailed),
+					},
+				},
+			},
+			&schema.SchemaField{
+				Name:     "total",
+				Type:     schema.FieldTypeNumber,
+				Required: false,
+				Options:  &schema.NumberOptions{NoDecimal: true},
+			},
+			&schema.SchemaField{
+				Name:     "succeeded",
+				Type:     schema.FieldTypeNumber,
+				Required: false,
+				Options:  &schema.NumberOptions{NoDecimal: true},
+			},
+			&schema.SchemaField{
+				Name:     "failed",
+				Type:     schema.FieldTypeNumber,
+				Required: false,
+				Options:  &schema.NumberOptions{NoDecimal: true},
+			},
+		),
+		Indexes: types.JsonArray[string]{
+			fmt.Sprintf("CREATE INDEX idx_%s_user ON %s (user)", collectionName, collectionName),
+		},
+	}
+
+	for _, field := range dubbingOptionsSchemaFields() {
+		collection.Schema.AddField(field)
+	}
+	for _, field := range publishOptionsSchemaFields() {
+		collection.Schema.AddField(field)
+	}
+
+	if err := upsertCollection(app, existingCollection, collection); err != nil {
+		log.Fatalf("%s collection failed: %+v", collectionName, err)
+	}
+}
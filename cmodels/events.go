@@ -1,6 +1,7 @@
 package cmodels
 
 import (
+	"basedpocket/utils"
 	"fmt"
 	"log"
 
@@ -53,6 +54,24 @@ func (m *Event) TableName() string {
 	return events
 }
 
+func (m *Event) SaveEvent(app core.App) *utils.CError {
+	return Save(app, m)
+}
+
+// RecordEvent adds an event to the user's feed. A failure is only logged,
+// it never fails the action the event is about.
+func RecordEvent(app core.App, userID string, channelID string, status EventStatus, message string) {
+	event := &Event{
+		User:    userID,
+		Channel: channelID,
+		Message: message,
+		Status:  string(status),
+	}
+	if err := event.SaveEvent(app); err != nil {
+		app.Logger().Error("event not recorded", "user", userID, "message", message, "error", err.Error)
+	}
+}
+
 // ============================================
 
 func createEventCollection(app core.App) {
@@ -60,9 +79,6 @@ func createEventCollection(app core.App) {
 	collectionName := events
 
 	existingCollection, _ := app.Dao().FindCollectionByNameOrId(collectionName)
-	if existingCollection != nil {
-		return
-	}
 
 	users, err := app.Dao().FindCollectionByNameOrId(users)
 	if err != nil {
@@ -96,7 +112,7 @@ func createEventCollection(app core.App) {
 			&schema.SchemaField{
 				Name:     "channel",
 				Type:     schema.FieldTypeRelation,
-				Required: true,
+				Required: false,
 				Options: &schema.RelationOptions{
 					MaxSelect:     types.Pointer(1),
 					CollectionId:  channels.Id,
@@ -117,11 +133,11 @@ func createEventCollection(app core.App) {
 			},
 		),
 		Indexes: types.JsonArray[string]{
-			fmt.Sprintf("CREATE UNIQUE INDEX idx_user ON %s (user)", collectionName),
+			fmt.Sprintf("CREATE INDEX idx_%s_user ON %s (user)", collectionName, collectionName),
 		},
 	}
 
-	if err := app.Dao().SaveCollection(collection); err != nil {
+	if err := upsertCollection(app, existingCollection, collection); err != nil {
 		log.Fatalf("%s collection failed: %+v", collectionName, err)
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"basedpocket/utils"
 	"database/sql"
 	"errors"
+	"reflect"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/labstack/echo/v5"
@@ -64,3 +65,57 @@ func Delete[T any](app core.App, item T) *utils.CError {
 	}
 	return nil
 }
+
+// FindFirstByParams loads into item the first row of its table that matches
+// every non-zero field of params, using the fields' db tags as columns.
+func FindFirstByParams[T models.Model](app core.App, item T, params any) *utils.CError {
+	err := app.Dao().ModelQuery(item).AndWhere(paramsToExp(params)).Limit(1).One(item)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return &utils.CError{Message: "Not Found", Error: err}
+	}
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return nil
+}
+
+func paramsToExp(params any) dbx.HashExp {
+	exp := dbx.HashExp{}
+	value := reflect.Indirect(reflect.ValueOf(params))
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		column := field.Tag.Get("db")
+		if column == "" || value.Field(i).IsZero() {
+			continue
+		}
+		exp[column] = value.Field(i).Interface()
+	}
+	return exp
+}
+
+// upsertCollection saves collection as a new collection, or when it already
+// exists as existing, brings existing up to date field by field: missing
+// fields are added, fields of the same name take the wanted type, required
+// flag and options, and the indexes are replaced. Fields that are no longer
+// wanted are left alone so no data is dropped.
+func upsertCollection(app core.App, existing *models.Collection, collection *models.Collection) error {
+	if existing == nil {
+		return app.Dao().SaveCollection(collection)
+	}
+
+	for _, field := range collection.Schema.Fields() {
+		current := existing.Schema.GetFieldByName(field.Name)
+		if current == nil {
+			existing.Schema.AddField(field)
+			continue
+		}
+		current.Type = field.Type
+		current.Required = field.Required
+		current.Options = field.Options
+	}
+	existing.Indexes = collection.Indexes
+
+	return app.Dao().SaveCollection(existing)
+}
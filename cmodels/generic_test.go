@@ -0,0 +1,56 @@
+// PocketBase v0.22 can't decode collection schemas with the json v2
+// experiment, tests that need a database only build without it.
+
+//go:build !goexperiment.jsonv2
+
+package cmodels
+
+import (
+	"testing"
+
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+func TestCreateCollectionsUpgradesExistingSchema(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	CreateCollections(app)
+
+	// roll dubjobs back to an older schema
+	collection, err := app.Dao().FindCollectionByNameOrId(dubjobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection.Schema.RemoveField(collection.Schema.GetFieldByName("publish_id").Id)
+	status := collection.Schema.GetFieldByName("status")
+	status.Options = &schema.SelectOptions{MaxSelect: 1, Values: []string{string(DubjobQueued), string(DubjobFailed)}}
+	collection.Indexes = nil
+	if err := app.Dao().SaveCollection(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	CreateCollections(app)
+
+	upgraded, err := app.Dao().FindCollectionByNameOrId(dubjobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upgraded.Schema.GetFieldByName("publish_id") == nil {
+		t.Error("publish_id was not added back")
+	}
+	if upgraded.Schema.GetFieldByName("status").Id != status.Id {
+		t.Error("status changed its field id")
+	}
+	values := upgraded.Schema.GetFieldByName("status").Options.(*schema.SelectOptions).Values
+	if len(values) != len(allowedDubjobTransitions)+2 {
+		t.Errorf("status values were not upgraded: %v", values)
+	}
+	if len(upgraded.Indexes) == 0 {
+		t.Error("indexes were not restored")
+	}
+}
@@ -0,0 +1,317 @@
+package cmodels
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// Dubbing provider names, as stored on Dubjob.Provider.
+const ElevenlabsProvider string = "elevenlabs"
+const FakeProvider string = "fake"
+
+// AutoLanguage lets the provider detect the source language.
+const AutoLanguage string = "auto"
+
+var ErrUnknownLanguage = errors.New("unknown language")
+
+// Language is an ISO 639-1 code together with the dubbing providers that
+// can dub into it and the platforms a channel in it can publish to.
+type Language struct {
+	Code      string   `json:"code"`
+	Name      string   `json:"name"`
+	Providers []string `json:"providers"`
+	Platforms []string `json:"platforms"`
+}
+
+func (l Language) SupportsProvider(provider string) bool {
+	for _, p := range l.Providers {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
+
+func (l Language) SupportsPlatform(platform string) bool {
+	for _, p := range l.Platforms {
+		if p == platform {
+			return true
+		}
+	}
+	return false
+}
+
+// dubbingProviders support the languages of ElevenLabs dubbing. The fake
+// provider mirrors ElevenLabs so the same requests work against both.
+// Filipino is dubbed by ElevenLabs too but has no ISO 639-1 code.
+var dubbingProviders = []string{ElevenlabsProvider, FakeProvider}
+
+// connectedPlatforms accept videos in every language, a language that a
+// platform does not support should list the ones it does explicitly.
+var connectedPlatforms = []string{string(TikTokPlatform), string(YoutubePlatform)}
+
+var languages = []Language{
+	{Code: "aa", Name: "Afar"},
+	{Code: "ab", Name: "Abkhazian"},
+	{Code: "ae", Name: "Avestan"},
+	{Code: "af", Name: "Afrikaans"},
+	{Code: "ak", Name: "Akan"},
+	{Code: "am", Name: "Amharic"},
+	{Code: "an", Name: "Aragonese"},
+	{Code: "ar", Name: "Arabic", Providers: dubbingProviders},
+	{Code: "as", Name: "Assamese"},
+	{Code: "av", Name: "Avaric"},
+	{Code: "ay", Name: "Aymara"},
+	{Code: "az", Name: "Azerbaijani"},
+	{Code: "ba", Name: "Bashkir"},
+	{Code: "be", Name: "Belarusian"},
+	{Code: "bg", Name: "Bulgarian", Providers: dubbingProviders},
+	{Code: "bi", Name: "Bislama"},
+	{Code: "bm", Name: "Bambara"},
+	{Code: "bn", Name: "Bengali"},
+	{Code: "bo", Name: "Tibetan"},
+	{Code: "br", Name: "Breton"},
+	{Code: "bs", Name: "Bosnian"},
+	{Code: "ca", Name: "Catalan"},
+	{Code: "ce", Name: "Chechen"},
+	{Code: "ch", Name: "Chamorro"},
+	{Code: "co", Name: "Corsican"},
+	{Code: "cr", Name: "Cree"},
+	{Code: "cs", Name: "Czech", Providers: dubbingProviders},
+	{Code: "cu", Name: "Church Slavic"},
+	{Code: "cv", Name: "Chuvash"},
+	{Code: "cy", Name: "Welsh"},
+	{Code: "da", Name: "Danish", Providers: dubbingProviders},
+	{Code: "de", Name: "German", Providers: dubbingProviders},
+	{Code: "dv", Name: "Divehi"},
+	{Code: "dz", Name: "Dzongkha"},
+	{Code: "ee", Name: "Ewe"},
+	{Code: "el", Name: "Greek", Providers: dubbingProviders},
+	{Code: "en", Name: "English", Providers: dubbingProviders},
+	{Code: "eo", Name: "Esperanto"},
+	{Code: "es", Name: "Spanish", Providers: dubbingProviders},
+	{Code: "et", Name: "Estonian"},
+	{Code: "eu", Name: "Basque"},
+	{Code: "fa", Name: "Persian"},
+	{Code: "ff", Name: "Fulah"},
+	{Code: "fi", Name: "Finnish", Providers: dubbingProviders},
+	{Code: "fj", Name: "Fijian"},
+	{Code: "fo", Name: "Faroese"},
+	{Code: "fr", Name: "French", Providers: dubbingProviders},
+	{Code: "fy", Name: "Western Frisian"},
+	{Code: "ga", Name: "Irish"},
+	{Code: "gd", Name: "Scottish Gaelic"},
+	{Code: "gl", Name: "Galician"},
+	{Code: "gn", Name: "Guarani"},
+	{Code: "gu", Name: "Gujarati"},
+	{Code: "gv", Name: "Manx"},
+	{Code: "ha", Name: "Hausa"},
+	{Code: "he", Name: "Hebrew"},
+	{Code: "hi", Name: "Hindi", Providers: dubbingProviders},
+	{Code: "ho", Name: "Hiri Motu"},
+	{Code: "hr", Name: "Croatian", Providers: dubbingProviders},
+	{Code: "ht", Name: "Haitian"},
+	{Code: "hu", Name: "Hungarian"},
+	{Code: "hy", Name: "Armenian"},
+	{Code: "hz", Name: "Herero"},
+	{Code: "ia", Name: "Interlingua"},
+	{Code: "id", Name: "Indonesian", Providers: dubbingProviders},
+	{Code: "ie", Name: "Interlingue"},
+	{Code: "ig", Name: "Igbo"},
+	{Code: "ii", Name: "Sichuan Yi"},
+	{Code: "ik", Name: "Inupiaq"},
+	{Code: "io", Name: "Ido"},
+	{Code: "is", Name: "Icelandic"},
+	{Code: "it", Name: "Italian", Providers: dubbingProviders},
+	{Code: "iu", Name: "Inuktitut"},
+	{Code: "ja", Name: "Japanese", Providers: dubbingProviders},
+	{Code: "jv", Name: "Javanese"},
+	{Code: "ka", Name: "Georgian"},
+	{Code: "kg", Name: "Kongo"},
+	{Code: "ki", Name: "Kikuyu"},
+	{Code: "kj", Name: "Kuanyama"},
+	{Code: "kk", Name: "Kazakh"},
+	{Code: "kl", Name: "Kalaallisut"},
+	{Code: "km", Name: "Khmer"},
+	{Code: "kn", Name: "Kannada"},
+	{Code: "ko", Name: "Korean", Providers: dubbingProviders},
+	{Code: "kr", Name: "Kanuri"},
+	{Code: "ks", Name: "Kashmiri"},
+	{Code: "ku", Name: "Kurdish"},
+	{Code: "kv", Name: "Komi"},
+	{Code: "kw", Name: "Cornish"},
+	{Code: "ky", Name: "Kyrgyz"},
+	{Code: "la", Name: "Latin"},
+	{Code: "lb", Name: "Luxembourgish"},
+	{Code: "lg", Name: "Ganda"},
+	{Code: "li", Name: "Limburgish"},
+	{Code: "ln", Name: "Lingala"},
+	{Code: "lo", Name: "Lao"},
+	{Code: "lt", Name: "Lithuanian"},
+	{Code: "lu", Name: "Luba-Katanga"},
+	{Code: "lv", Name: "Latvian"},
+	{Code: "mg", Name: "Malagasy"},
+	{Code: "mh", Name: "Marshallese"},
+	{Code: "mi", Name: "Maori"},
+	{Code: "mk", Name: "Macedonian"},
+	{Code: "ml", Name: "Malayalam"},
+	{Code: "mn", Name: "Mongolian"},
+	{Code: "mr", Name: "Marathi"},
+	{Code: "ms", Name: "Malay", Providers: dubbingProviders},
+	{Code: "mt", Name: "Maltese"},
+	{Code: "my", Name: "Burmese"},
+	{Code: "na", Name: "Nauru"},
+	{Code: "nb", Name: "Norwegian Bokmal"},
+	{Code: "nd", Name: "North Ndebele"},
+	{Code: "ne", Name: "Nepali"},
+	{Code: "ng", Name: "Ndonga"},
+	{Code: "nl", Name: "Dutch", Providers: dubbingProviders},
+	{Code: "nn", Name: "Norwegian Nynorsk"},
+	{Code: "no", Name: "Norwegian"},
+	{Code: "nr", Name: "South Ndebele"},
+	{Code: "nv", Name: "Navajo"},
+	{Code: "ny", Name: "Chichewa"},
+	{Code: "oc", Name: "Occitan"},
+	{Code: "oj", Name: "Ojibwa"},
+	{Code: "om", Name: "Oromo"},
+	{Code: "or", Name: "Oriya"},
+	{Code: "os", Name: "Ossetian"},
+	{Code: "pa", Name: "Punjabi"},
+	{Code: "pi", Name: "Pali"},
+	{Code: "pl", Name: "Polish", Providers: dubbingProviders},
+	{Code: "ps", Name: "Pashto"},
+	{Code: "pt", Name: "Portuguese", Providers: dubbingProviders},
+	{Code: "qu", Name: "Quechua"},
+	{Code: "rm", Name: "Romansh"},
+	{Code: "rn", Name: "Rundi"},
+	{Code: "ro", Name: "Romanian", Providers: dubbingProviders},
+	{Code: "ru", Name: "Russian", Providers: dubbingProviders},
+	{Code: "rw", Name: "Kinyarwanda"},
+	{Code: "sa", Name: "Sanskrit"},
+	{Code: "sc", Name: "Sardinian"},
+	{Code: "sd", Name: "Sindhi"},
+	{Code: "se", Name: "Northern Sami"},
+	{Code: "sg", Name: "Sango"},
+	{Code: "si", Name: "Sinhala"},
+	{Code: "sk", Name: "Slovak", Providers: dubbingProviders},
+	{Code: "sl", Name: "Slovenian"},
+	{Code: "sm", Name: "Samoan"},
+	{Code: "sn", Name: "Shona"},
+	{Code: "so", Name: "Somali"},
+	{Code: "sq", Name: "Albanian"},
+	{Code: "sr", Name: "Serbian"},
+	{Code: "ss", Name: "Swati"},
+	{Code: "st", Name: "Southern Sotho"},
+	{Code: "su", Name: "Sundanese"},
+	{Code: "sv", Name: "Swedish", Providers: dubbingProviders},
+	{Code: "sw", Name: "Swahili"},
+	{Code: "ta", Name: "Tamil", Providers: dubbingProviders},
+	{Code: "te", Name: "Telugu"},
+	{Code: "tg", Name: "Tajik"},
+	{Code: "th", Name: "Thai"},
+	{Code: "ti", Name: "Tigrinya"},
+	{Code: "tk", Name: "Turkmen"},
+	{Code: "tl", Name: "Tagalog"},
+	{Code: "tn", Name: "Tswana"},
+	{Code: "to", Name: "Tonga"},
+	{Code: "tr", Name: "Turkish", Providers: dubbingProviders},
+	{Code: "ts", Name: "Tsonga"},
+	{Code: "tt", Name: "Tatar"},
+	{Code: "tw", Name: "Twi"},
+	{Code: "ty", Name: "Tahitian"},
+	{Code: "ug", Name: "Uyghur"},
+	{Code: "uk", Name: "Ukrainian", Providers: dubbingProviders},
+	{Code: "ur", Name: "Urdu"},
+	{Code: "uz", Name: "Uzbek"},
+	{Code: "ve", Name: "Venda"},
+	{Code: "vi", Name: "Vietnamese"},
+	{Code: "vo", Name: "Volapuk"},
+	{Code: "wa", Name: "Walloon"},
+	{Code: "wo", Name: "Wolof"},
+	{Code: "xh", Name: "Xhosa"},
+	{Code: "yi", Name: "Yiddish"},
+	{Code: "yo", Name: "Yoruba"},
+	{Code: "za", Name: "Zhuang"},
+	{Code: "zh", Name: "Chinese", Providers: dubbingProviders},
+	{Code: "zu", Name: "Zulu"},
+}
+
+var languagesByCode = map[string]Language{}
+
+func init() {
+	for i := range languages {
+		if languages[i].Providers == nil {
+			languages[i].Providers = []string{}
+		}
+		if languages[i].Platforms == nil {
+			languages[i].Platforms = connectedPlatforms
+		}
+		languagesByCode[languages[i].Code] = languages[i]
+	}
+}
+
+// GetLanguages returns the registry ordered by code.
+func GetLanguages() []Language {
+	return languages
+}
+
+func GetLanguage(code string) (Language, bool) {
+	language, ok := languagesByCode[code]
+	return language, ok
+}
+
+func IsLanguage(code string) bool {
+	_, ok := languagesByCode[code]
+	return ok
+}
+
+// ValidateLanguage rejects codes that are not in the registry. An empty
+// code is accepted, whether it is required is up to the caller.
+func ValidateLanguage(field string, code string) error {
+	if code == "" || IsLanguage(code) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s %q", ErrUnknownLanguage, field, code)
+}
+
+// ============================================
+
+// validateModelLanguages runs before every save of a model or record that
+// holds language codes, so an unknown code never reaches a provider.
+func validateModelLanguages(e *core.ModelEvent) error {
+	switch m := e.Model.(type) {
+	case *Channel:
+		return ValidateLanguage("language", m.Language)
+	case *Dubjob:
+		return validateDubbingLanguages(m.SourceLanguage, m.TargetLanguage)
+	case *DubRequest:
+		return validateDubbingLanguages(m.SourceLanguage, m.TargetLanguages...)
+	case *models.Record:
+		switch m.Collection().Name {
+		case channels:
+			return ValidateLanguage("language", m.GetString("language"))
+		case dubjobs:
+			return validateDubbingLanguages(m.GetString("source_language"), m.GetString("target_language"))
+		case dubRequests:
+			return validateDubbingLanguages(m.GetString("source_language"), m.GetStringSlice("target_languages")...)
+		}
+	}
+	return nil
+}
+
+func validateDubbingLanguages(source string, targets ...string) error {
+	if source != AutoLanguage {
+		if err := ValidateLanguage("source_language", source); err != nil {
+			return err
+		}
+	}
+	for _, target := range targets {
+		if err := ValidateLanguage("target_language", target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -12,13 +12,29 @@ func LoadModels(app *pocketbase.PocketBase, env *base.Env) {
 	app.OnBeforeServe().Add(func(e *core.ServeEvent) error {
 		// ===================
 		// collections
-		createCustomersCollection(e.App)
-		createPlatformCollection(e.App)
-		createChannelCollection(e.App)
-		createEventCollection(e.App)
-		createDubjobCollection(e.App)
-		createOAuthCollection(e.App)
+		CreateCollections(e.App)
 
 		return nil
 	})
+
+	// ===================
+	// validation
+	app.OnModelBeforeCreate(channels, dubjobs, dubRequests).Add(validateModelLanguages)
+	app.OnModelBeforeUpdate(channels, dubjobs, dubRequests).Add(validateModelLanguages)
+}
+
+// CreateCollections creates every collection of the app, or upgrades the
+// ones an older version already created. The order follows the relations.
+func CreateCollections(app core.App) {
+	createCustomersCollection(app)
+	createPlatformCollection(app)
+	createChannelCollection(app)
+	createEventCollection(app)
+	createVideoCollection(app)
+	createDubRequestCollection(app)
+	createDubjobCollection(app)
+	createDubjobTransitionCollection(app)
+	createUsageCollection(app)
+	createOAuthCollection(app)
+	createOAuthStateCollection(app)
 }
@@ -0,0 +1,16 @@
+package cmodels
+
+import (
+	"os"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestMain(m *testing.M) {
+	// errors are captured like in production, without a DSN nothing is sent
+	if err := sentry.Init(sentry.ClientOptions{}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
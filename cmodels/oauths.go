@@ -1,8 +1,13 @@
 package cmodels
 
 import (
+	"basedpocket/utils"
 	"fmt"
 	"log"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pocketbase/dbx"
 
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/models"
@@ -24,11 +29,49 @@ type OAuth struct {
 	RefreshToken          string          `db:"refresh_token" json:"refresh_token"`
 	RefreshTokenExpiresIn *types.DateTime `db:"refresh_token_expires_in" json:"refresh_token_expires_in"`
 }
+type FindOAuthParams struct {
+	Id      string `db:"id"`
+	User    string `db:"user"`
+	Channel string `db:"channel"`
+}
 
 func (m *OAuth) TableName() string {
 	return oauths // the name of your collection
 }
 
+func (m *OAuth) FindOAuth(app core.App, params *FindOAuthParams) *utils.CError {
+	return FindFirstByParams(app, m, params)
+}
+
+func (m *OAuth) SaveOAuth(app core.App) *utils.CError {
+	return Save(app, m)
+}
+
+func (m *OAuth) DeleteOAuth(app core.App) *utils.CError {
+	return Delete(app, m)
+}
+
+// FindExpiringOAuths returns the oauths whose access token expires at or
+// before before, soonest first.
+func FindExpiringOAuths(app core.App, before time.Time) ([]*OAuth, *utils.CError) {
+	beforeDate, err := types.ParseDateTime(before)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+
+	found := []*OAuth{}
+	err = app.Dao().ModelQuery(&OAuth{}).
+		AndWhere(dbx.NewExp("access_token_expires_in <= {:before}", dbx.Params{"before": beforeDate.String()})).
+		OrderBy("access_token_expires_in ASC").
+		All(&found)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return found, nil
+}
+
 // ============================================
 
 func createOAuthCollection(app core.App) {
@@ -37,9 +80,6 @@ func createOAuthCollection(app core.App) {
 	collectionName := oauths
 
 	existingCollection, _ := app.Dao().FindCollectionByNameOrId(collectionName)
-	if existingCollection != nil {
-		return
-	}
 
 	users, err := app.Dao().FindCollectionByNameOrId(users)
 	if err != nil {
@@ -116,7 +156,7 @@ func createOAuthCollection(app core.App) {
 		},
 	}
 
-	if err := app.Dao().SaveCollection(collection); err != nil {
+	if err := upsertCollection(app, existingCollection, collection); err != nil {
 		log.Fatalf("%s collection failed: %+v", collectionName, err)
 	}
 }
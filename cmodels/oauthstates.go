@@ -0,0 +1,160 @@
+package cmodels
+
+import (
+	"basedpocket/utils"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pocketbase/dbx"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const oauthStates string = "oauth_states"
+
+var _ models.Model = (*OAuthState)(nil)
+
+// OAuthState is an OAuth authorization in progress. It binds the state sent
+// to the platform to the user who started the flow and holds the PKCE
+// code_verifier of the token exchange.
+type OAuthState struct {
+	models.BaseModel
+	User         string         `db:"user" json:"user"`
+	Platform     PlatformName   `db:"platform" json:"platform"`
+	State        string         `db:"state" json:"-"`
+	CodeVerifier string         `db:"code_verifier" json:"-"`
+	ExpiresIn    types.DateTime `db:"expires_in" json:"expires_in"`
+}
+type FindOAuthStateParams struct {
+	Id       string       `db:"id"`
+	User     string       `db:"user"`
+	Platform PlatformName `db:"platform"`
+	State    string       `db:"state"`
+}
+
+func (m *OAuthState) TableName() string {
+	return oauthStates // the name of your collection
+}
+
+func (m *OAuthState) FindOAuthState(app core.App, params *FindOAuthStateParams) *utils.CError {
+	return FindFirstByParams(app, m, params)
+}
+
+func (m *OAuthState) SaveOAuthState(app core.App) *utils.CError {
+	return Save(app, m)
+}
+
+// ConsumeOAuthState loads and deletes the state of platform, so a state can
+// only ever be used once. Unknown, already used and expired states are all
+// reported as not found.
+func (m *OAuthState) ConsumeOAuthState(app core.App, platform PlatformName, state string) *utils.CError {
+	if state == "" {
+		return &utils.CError{Message: "Not Found", Error: fmt.Errorf("oauth state is empty: %w", sql.ErrNoRows)}
+	}
+	if err := m.FindOAuthState(app, &FindOAuthStateParams{Platform: platform, State: state}); err != nil {
+		return err
+	}
+
+	// only the request that deletes the row may use it
+	res, err := app.Dao().DB().Delete(oauthStates, dbx.HashExp{"id": m.Id}).Execute()
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected != 1 {
+		return &utils.CError{Message: "Not Found", Error: fmt.Errorf("oauth state already used: %w", sql.ErrNoRows)}
+	}
+	if m.ExpiresIn.Time().Before(time.Now()) {
+		return &utils.CError{Message: "Not Found", Error: fmt.Errorf("oauth state expired: %w", sql.ErrNoRows)}
+	}
+	return nil
+}
+
+// DeleteExpiredOAuthStates removes the states of abandoned authorizations.
+func DeleteExpiredOAuthStates(app core.App, before time.Time) *utils.CError {
+	beforeDate, err := types.ParseDateTime(before)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+
+	_, err = app.Dao().DB().Delete(oauthStates, dbx.NewExp("expires_in <= {:before}", dbx.Params{"before": beforeDate.String()})).Execute()
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return nil
+}
+
+// ============================================
+
+func createOAuthStateCollection(app core.App) {
+
+	collectionName := oauthStates
+
+	existingCollection, _ := app.Dao().FindCollectionByNameOrId(collectionName)
+
+	users, err := app.Dao().FindCollectionByNameOrId(users)
+	if err != nil {
+		log.Fatalf("users table not found: %+v", err)
+	}
+
+	collection := &models.Collection{
+		Name:       collectionName,
+		Type:       models.CollectionTypeBase,
+		ListRule:   nil,
+		ViewRule:   nil,
+		CreateRule: nil,
+		UpdateRule: nil,
+		DeleteRule: nil,
+		Schema: schema.NewSchema(
+			&schema.SchemaField{
+				Name:     "user",
+				Type:     schema.FieldTypeRelation,
+				Required: true,
+				Options: &schema.RelationOptions{
+					MaxSelect:     types.Pointer(1),
+					CollectionId:  users.Id,
+					CascadeDelete: true,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "platform",
+				Type:     schema.FieldTypeText,
+				Required: true,
+				Options:  &schema.TextOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "state",
+				Type:     schema.FieldTypeText,
+				Required: true,
+				Options:  &schema.TextOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "code_verifier",
+				Type:     schema.FieldTypeText,
+				Required: true,
+				Options:  &schema.TextOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "expires_in",
+				Type:     schema.FieldTypeDate,
+				Required: true,
+				Options:  &schema.DateOptions{},
+			},
+		),
+		Indexes: types.JsonArray[string]{
+			fmt.Sprintf("CREATE UNIQUE INDEX idx_%s_state ON %s (state)", collectionName, collectionName),
+		},
+	}
+
+	if err := upsertCollection(app, existingCollection, collection); err != nil {
+		log.Fatalf("%s collection failed: %+v", collectionName, err)
+	}
+}
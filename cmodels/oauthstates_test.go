@@ -0,0 +1,67 @@
+// PocketBase v0.22 can't decode collection schemas with the json v2
+// experiment, tests that need a database only build without it.
+
+//go:build !goexperiment.jsonv2
+
+package cmodels
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func TestConsumeOAuthState(t *testing.T) {
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+	CreateCollections(app)
+
+	newState := func(state string, lifetime time.Duration) {
+		t.Helper()
+		expiresIn, err := types.ParseDateTime(time.Now().Add(lifetime))
+		if err != nil {
+			t.Fatal(err)
+		}
+		oauthState := &OAuthState{User: "test_user", Platform: TikTokPlatform, State: state, CodeVerifier: "verifier_" + state, ExpiresIn: expiresIn}
+		if err := oauthState.SaveOAuthState(app); err != nil {
+			t.Fatal(err)
+		}
+	}
+	newState("fresh", time.Minute)
+	newState("expired", -time.Minute)
+	newState("pending", time.Minute)
+
+	consumed := &OAuthState{}
+	if err := consumed.ConsumeOAuthState(app, TikTokPlatform, "fresh"); err != nil {
+		t.Fatal(err)
+	}
+	if consumed.CodeVerifier != "verifier_fresh" {
+		t.Fatalf("the state lost its verifier: %+v", consumed)
+	}
+
+	cases := []struct {
+		name     string
+		platform PlatformName
+		state    string
+	}{
+		{"already used", TikTokPlatform, "fresh"},
+		{"expired", TikTokPlatform, "expired"},
+		{"expired and already deleted", TikTokPlatform, "expired"},
+		{"other platform", YoutubePlatform, "pending"},
+		{"unknown", TikTokPlatform, "unknown"},
+		{"empty", TikTokPlatform, ""},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			err := (&OAuthState{}).ConsumeOAuthState(app, test.platform, test.state)
+			if err == nil || !err.IsNotFound() {
+				t.Fatalf("expected not found, got %+v", err)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package cmodels
 
 import (
+	"basedpocket/utils"
 	"fmt"
 	"log"
 
@@ -28,14 +29,23 @@ type Platform struct {
 	Name PlatformName `db:"name" json:"name"`
 }
 type FindPlatformParams struct {
-	Id   string `db:"id"`
-	User string `db:"user"`
+	Id   string       `db:"id"`
+	User string       `db:"user"`
+	Name PlatformName `db:"name"`
 }
 
 func (m *Platform) TableName() string {
 	return platforms // the name of your collection
 }
 
+func (m *Platform) FindPlatform(app core.App, params *FindPlatformParams) *utils.CError {
+	return FindFirstByParams(app, m, params)
+}
+
+func (m *Platform) SavePlatform(app core.App) *utils.CError {
+	return Save(app, m)
+}
+
 // ===================================
 
 func createPlatformCollection(app core.App) {
@@ -43,9 +53,6 @@ func createPlatformCollection(app core.App) {
 	collectionName := platforms
 
 	existingCollection, _ := app.Dao().FindCollectionByNameOrId(collectionName)
-	if existingCollection != nil {
-		return
-	}
 
 	users, err := app.Dao().FindCollectionByNameOrId(users)
 	if err != nil {
@@ -83,7 +90,7 @@ func createPlatformCollection(app core.App) {
 		},
 	}
 
-	if err := app.Dao().SaveCollection(collection); err != nil {
+	if err := upsertCollection(app, existingCollection, collection); err != nil {
 		log.Fatalf("%s collection failed: %+v", collectionName, err)
 	}
 }
@@ -0,0 +1,96 @@
+package cmodels
+
+import (
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+// PublishPrivacyLevels are the TikTok privacy levels a dub can be posted with.
+var PublishPrivacyLevels = []string{
+	"PUBLIC_TO_EVERYONE",
+	"MUTUAL_FOLLOW_FRIENDS",
+	"FOLLOWER_OF_CREATOR",
+	"SELF_ONLY",
+}
+
+// DefaultPublishPrivacyLevel is the only level TikTok allows for apps that
+// have not passed its audit, and the safe choice otherwise.
+const DefaultPublishPrivacyLevel string = "SELF_ONLY"
+
+// PublishOptions configure the post of a finished dub on the owning
+// channel. The struct is embedded in Dubjob and DubRequest, so they share
+// columns.
+type PublishOptions struct {
+	AutoPublish           bool   `db:"auto_publish" json:"auto_publish"`
+	PublishTitle          string `db:"publish_title" json:"publish_title" validate:"max=2200"`
+	PublishPrivacyLevel   string `db:"publish_privacy_level" json:"publish_privacy_level" validate:"omitempty,oneof=PUBLIC_TO_EVERYONE MUTUAL_FOLLOW_FRIENDS FOLLOWER_OF_CREATOR SELF_ONLY"`
+	PublishDisableComment bool   `db:"publish_disable_comment" json:"publish_disable_comment"`
+	PublishDisableDuet    bool   `db:"publish_disable_duet" json:"publish_disable_duet"`
+	PublishDisableStitch  bool   `db:"publish_disable_stitch" json:"publish_disable_stitch"`
+	// disclosure: the post promotes a third party (paid partnership)
+	PublishBrandContent bool `db:"publish_brand_content" json:"publish_brand_content"`
+	// disclosure: the post promotes the creator's own business
+	PublishBrandOrganic bool `db:"publish_brand_organic" json:"publish_brand_organic"`
+}
+
+func (o PublishOptions) GetPublishPrivacyLevel() string {
+	if o.PublishPrivacyLevel == "" {
+		return DefaultPublishPrivacyLevel
+	}
+	return o.PublishPrivacyLevel
+}
+
+func publishOptionsSchemaFields() []*schema.SchemaField {
+	return []*schema.SchemaField{
+		{
+			Name:     "auto_publish",
+			Type:     schema.FieldTypeBool,
+			Required: false,
+			Options:  &schema.BoolOptions{},
+		},
+		{
+			Name:     "publish_title",
+			Type:     schema.FieldTypeText,
+			Required: false,
+			Options:  &schema.TextOptions{},
+		},
+		{
+			Name:     "publish_privacy_level",
+			Type:     schema.FieldTypeSelect,
+			Required: false,
+			Options: &schema.SelectOptions{
+				MaxSelect: 1,
+				Values:    PublishPrivacyLevels,
+			},
+		},
+		{
+			Name:     "publish_disable_comment",
+			Type:     schema.FieldTypeBool,
+			Required: false,
+			Options:  &schema.BoolOptions{},
+		},
+		{
+			Name:     "publish_disable_duet",
+			Type:     schema.FieldTypeBool,
+			Required: false,
+			Options:  &schema.BoolOptions{},
+		},
+		{
+			Name:     "publish_disable_stitch",
+			Type:     schema.FieldTypeBool,
+			Required: false,
+			Options:  &schema.BoolOptions{},
+		},
+		{
+			Name:     "publish_brand_content",
+			Type:     schema.FieldTypeBool,
+			Required: false,
+			Options:  &schema.BoolOptions{},
+		},
+		{
+			Name:     "publish_brand_organic",
+			Type:     schema.FieldTypeBool,
+			Required: false,
+			Options:  &schema.BoolOptions{},
+		},
+	}
+}
@@ -0,0 +1,39 @@
+package cmodels
+
+// TierLimits is what a Customer.Tier entitles a user to.
+type TierLimits struct {
+	MonthlyDubSeconds int `json:"monthly_dub_seconds"`
+	// RetentionDays is how long the files of a settled dubjob are kept
+	RetentionDays int `json:"retention_days"`
+}
+
+// tierLimits is keyed by the tier metadata set on Stripe prices.
+// Tier 0 is the free tier, used when the user has no subscription.
+var tierLimits = map[int]TierLimits{
+	0: {MonthlyDubSeconds: 5 * 60, RetentionDays: 7},
+	1: {MonthlyDubSeconds: 120 * 60, RetentionDays: 30},
+	2: {MonthlyDubSeconds: 120 * 60, RetentionDays: 90},
+}
+
+// GetTierLimits returns the limits of the highest defined tier that is not
+// above the given one.
+func GetTierLimits(tier int) TierLimits {
+	best := 0
+	for defined := range tierLimits {
+		if defined <= tier && defined > best {
+			best = defined
+		}
+	}
+	return tierLimits[best]
+}
+
+// MinRetentionDays is the shortest retention of any tier.
+func MinRetentionDays() int {
+	min := -1
+	for _, limits := range tierLimits {
+		if min < 0 || limits.RetentionDays < min {
+			min = limits.RetentionDays
+		}
+	}
+	return min
+}
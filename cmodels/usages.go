@@ -0,0 +1,183 @@
+package cmodels
+
+import (
+	"basedpocket/utils"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+type UsageKind string
+
+const UsageReserve UsageKind = "reserve"
+const UsageRefund UsageKind = "refund"
+
+// UsageAdjust corrects a reservation once the real duration of the dubbed
+// media is known, in either direction.
+const UsageAdjust UsageKind = "adjust"
+
+// UsagePeriod is the billing period a moment falls in, e.g. "2026-10".
+func UsagePeriod(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// =========================================
+// =========================================
+
+const usages string = "usages"
+
+var _ models.Model = (*Usage)(nil)
+
+// Usage is an append-only ledger entry of dubbed seconds. Refunds are
+// stored as negative seconds so a period's usage is a plain sum.
+type Usage struct {
+	models.BaseModel
+	User    string    `db:"user" json:"user"`
+	Dubjob  string    `db:"dubjob" json:"dubjob"`
+	Period  string    `db:"period" json:"period"`
+	Kind    UsageKind `db:"kind" json:"kind"`
+	Seconds int       `db:"seconds" json:"seconds"`
+}
+
+func (m *Usage) TableName() string {
+	return usages // the name of your collection
+}
+
+// ============================================
+
+func SumUsageSeconds(dao *daos.Dao, user string, period string) (int, *utils.CError) {
+	var total struct {
+		Seconds int `db:"seconds"`
+	}
+	err := dao.DB().
+		Select("COALESCE(SUM(seconds), 0) AS seconds").
+		From(usages).
+		Where(dbx.HashExp{"user": user, "period": period}).
+		One(&total)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return 0, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return total.Seconds, nil
+}
+
+// SumDubjobUsageByPeriod is what is currently held against the user for a
+// dubjob, per period it was booked in.
+func SumDubjobUsageByPeriod(dao *daos.Dao, dubjob string) (map[string]int, *utils.CError) {
+	rows := []struct {
+		Period  string `db:"period"`
+		Seconds int    `db:"seconds"`
+	}{}
+	err := dao.DB().
+		Select("period", "COALESCE(SUM(seconds), 0) AS seconds").
+		From(usages).
+		Where(dbx.HashExp{"dubjob": dubjob}).
+		GroupBy("period").
+		All(&rows)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+
+	held := map[string]int{}
+	for _, row := range rows {
+		held[row.Period] = row.Seconds
+	}
+	return held, nil
+}
+
+func (m *Usage) SaveUsageWithDao(dao *daos.Dao) *utils.CError {
+	if err := dao.Save(m); err != nil {
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return nil
+}
+
+// ============================================
+
+func createUsageCollection(app core.App) {
+
+	collectionName := usages
+
+	existingCollection, _ := app.Dao().FindCollectionByNameOrId(collectionName)
+
+	users, err := app.Dao().FindCollectionByNameOrId(users)
+	if err != nil {
+		log.Fatalf("users table not found: %+v", err)
+	}
+
+	dubjobs, err := app.Dao().FindCollectionByNameOrId(dubjobs)
+	if err != nil {
+		log.Fatalf("dubjobs table not found: %+v", err)
+	}
+
+	collection := &models.Collection{
+		Name:       collectionName,
+		Type:       models.CollectionTypeBase,
+		ListRule:   types.Pointer("user.id = @request.auth.id"),
+		ViewRule:   types.Pointer("user.id = @request.auth.id"),
+		CreateRule: nil,
+		UpdateRule: nil,
+		DeleteRule: nil,
+		Schema: schema.NewSchema(
+			&schema.SchemaField{
+				Name:     "user",
+				Type:     schema.FieldTypeRelation,
+				Required: true,
+				Options: &schema.RelationOptions{
+					MaxSelect:     types.Pointer(1),
+					CollectionId:  users.Id,
+					CascadeDelete: true,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "dubjob",
+				Type:     schema.FieldTypeRelation,
+				Required: false,
+				Options: &schema.RelationOptions{
+					MaxSelect:     types.Pointer(1),
+					CollectionId:  dubjobs.Id,
+					CascadeDelete: false,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "period",
+				Type:     schema.FieldTypeText,
+				Required: true,
+				Options:  &schema.TextOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "kind",
+				Type:     schema.FieldTypeSelect,
+				Required: true,
+				Options: &schema.SelectOptions{
+					MaxSelect: 1,
+					Values:    []string{string(UsageReserve), string(UsageRefund), string(UsageAdjust)},
+				},
+			},
+			&schema.SchemaField{
+				Name:     "seconds",
+				Type:     schema.FieldTypeNumber,
+				Required: true,
+				Options:  &schema.NumberOptions{NoDecimal: true},
+			},
+		),
+		Indexes: types.JsonArray[string]{
+			fmt.Sprintf("CREATE INDEX idx_%s_user_period ON %s (user, period)", collectionName, collectionName),
+			fmt.Sprintf("CREATE INDEX idx_%s_dubjob ON %s (dubjob)", collectionName, collectionName),
+		},
+	}
+
+	if err := upsertCollection(app, existingCollection, collection); err != nil {
+		log.Fatalf("%s collection failed: %+v", collectionName, err)
+	}
+}
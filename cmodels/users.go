@@ -7,6 +7,7 @@ import (
 	"github.com/getsentry/sentry-go"
 	"github.com/labstack/echo/v5"
 	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/models"
 )
 
@@ -27,14 +28,23 @@ func (m *User) TableName() string {
 	return users // the name of your collection
 }
 
+func (m *User) FindUser(app core.App, params *FindUserParams) *utils.CError {
+	return FindFirstByParams(app, m, params)
+}
+
 // ===================================
 
 func (user *User) GetUserByContext(ctx echo.Context) *utils.CError {
-	user = ctx.Get(apis.ContextAuthRecordKey).(*User)
-	if user == nil {
+	record, _ := ctx.Get(apis.ContextAuthRecordKey).(*models.Record)
+	if record == nil {
 		err := fmt.Errorf("user not found")
 		eventID := sentry.CaptureException(err)
 		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
 	}
+	user.Id = record.Id
+	user.Created = record.Created
+	user.Updated = record.Updated
+	user.Email = record.Email()
+	user.MarkAsNotNew()
 	return nil
 }
@@ -0,0 +1,170 @@
+package cmodels
+
+import (
+	"basedpocket/utils"
+	"fmt"
+	"log"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const videos string = "videos"
+
+var _ models.Model = (*Video)(nil)
+
+// Video is a video of a channel imported from its platform, to be picked
+// as the source of a dubjob.
+type Video struct {
+	models.BaseModel
+	User          string         `db:"user" json:"user"`
+	Channel       string         `db:"channel" json:"channel"`
+	ExternalID    string         `db:"external_id" json:"external_id"`
+	Title         string         `db:"title" json:"title"`
+	Description   string         `db:"description" json:"description"`
+	DurationSec   int            `db:"duration_sec" json:"duration_sec"`
+	CoverImageURL string         `db:"cover_image_url" json:"cover_image_url"`
+	ShareURL      string         `db:"share_url" json:"share_url"`
+	EmbedURL      string         `db:"embed_url" json:"embed_url"`
+	ViewCount     int64          `db:"view_count" json:"view_count"`
+	PostedIn      types.DateTime `db:"posted_in" json:"posted_in"`
+	SyncedIn      types.DateTime `db:"synced_in" json:"synced_in"`
+}
+type FindVideoParams struct {
+	Id         string `db:"id"`
+	User       string `db:"user"`
+	Channel    string `db:"channel"`
+	ExternalID string `db:"external_id"`
+}
+
+func (m *Video) TableName() string {
+	return videos // the name of your collection
+}
+
+func (m *Video) FindVideo(app core.App, params *FindVideoParams) *utils.CError {
+	return FindFirstByParams(app, m, params)
+}
+
+func (m *Video) SaveVideo(app core.App) *utils.CError {
+	return Save(app, m)
+}
+
+// ============================================
+
+func createVideoCollection(app core.App) {
+
+	collectionName := videos
+
+	existingCollection, _ := app.Dao().FindCollectionByNameOrId(collectionName)
+
+	users, err := app.Dao().FindCollectionByNameOrId(users)
+	if err != nil {
+		log.Fatalf("users table not found: %+v", err)
+	}
+
+	channels, err := app.Dao().FindCollectionByNameOrId(channels)
+	if err != nil {
+		log.Fatalf("channels table not found: %+v", err)
+	}
+
+	collection := &models.Collection{
+		Name:       collectionName,
+		Type:       models.CollectionTypeBase,
+		ListRule:   types.Pointer("user.id = @request.auth.id"),
+		ViewRule:   types.Pointer("user.id = @request.auth.id"),
+		CreateRule: nil,
+		UpdateRule: nil,
+		DeleteRule: nil,
+		Schema: schema.NewSchema(
+			&schema.SchemaField{
+				Name:     "user",
+				Type:     schema.FieldTypeRelation,
+				Required: true,
+				Options: &schema.RelationOptions{
+					MaxSelect:     types.Pointer(1),
+					CollectionId:  users.Id,
+					CascadeDelete: true,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "channel",
+				Type:     schema.FieldTypeRelation,
+				Required: true,
+				Options: &schema.RelationOptions{
+					MaxSelect:     types.Pointer(1),
+					CollectionId:  channels.Id,
+					CascadeDelete: true,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "external_id",
+				Type:     schema.FieldTypeText,
+				Required: true,
+				Options:  &schema.TextOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "title",
+				Type:     schema.FieldTypeText,
+				Required: false,
+				Options:  &schema.TextOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "description",
+				Type:     schema.FieldTypeText,
+				Required: false,
+				Options:  &schema.TextOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "duration_sec",
+				Type:     schema.FieldTypeNumber,
+				Required: false,
+				Options:  &schema.NumberOptions{NoDecimal: true},
+			},
+			&schema.SchemaField{
+				Name:     "cover_image_url",
+				Type:     schema.FieldTypeUrl,
+				Required: false,
+				Options:  &schema.UrlOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "share_url",
+				Type:     schema.FieldTypeUrl,
+				Required: false,
+				Options:  &schema.UrlOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "embed_url",
+				Type:     schema.FieldTypeUrl,
+				Required: false,
+				Options:  &schema.UrlOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "view_count",
+				Type:     schema.FieldTypeNumber,
+				Required: false,
+				Options:  &schema.NumberOptions{NoDecimal: true},
+			},
+			&schema.SchemaField{
+				Name:     "posted_in",
+				Type:     schema.FieldTypeDate,
+				Required: false,
+				Options:  &schema.DateOptions{},
+			},
+			&schema.SchemaField{
+				Name:     "synced_in",
+				Type:     schema.FieldTypeDate,
+				Required: false,
+				Options:  &schema.DateOptions{},
+			},
+		),
+		Indexes: types.JsonArray[string]{
+			fmt.Sprintf("CREATE UNIQUE INDEX idx_%s_channel_external_id ON %s (channel, external_id)", collectionName, collectionName),
+		},
+	}
+
+	if err := upsertCollection(app, existingCollection, collection); err != nil {
+		log.Fatalf("%s collection failed: %+v", collectionName, err)
+	}
+}
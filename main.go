@@ -3,7 +3,9 @@ package main
 import (
 	"basedpocket/base"
 	"basedpocket/cmodels"
+	"basedpocket/services/dubbing"
 	"basedpocket/services/payment"
+	"basedpocket/services/tiktok"
 	"log"
 
 	"github.com/pocketbase/pocketbase"
@@ -19,7 +21,8 @@ func main() {
 
 	cmodels.LoadModels(app, env)
 	payment.LoadPayment(app, env)
-	// tiktok.LoadTiktok(app, env)
+	dubbing.LoadDubbing(app, env)
+	tiktok.LoadTiktok(app, env)
 
 	if err := app.Start(); err != nil {
 		log.Fatal(err)
@@ -0,0 +1,62 @@
+// PocketBase v0.22 can't decode collection schemas with the json v2
+// experiment, tests that need a database only build without it.
+
+//go:build !goexperiment.jsonv2
+
+package dubbing
+
+import (
+	"basedpocket/cmodels"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+// newTestApp returns an app on a throwaway copy of PocketBase's test data
+// with every collection of ours created.
+func newTestApp(t *testing.T) *tests.TestApp {
+	t.Helper()
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(app.Cleanup)
+	cmodels.CreateCollections(app)
+	return app
+}
+
+// newTestUser creates a user without a subscription, so on the free tier.
+func newTestUser(t *testing.T, app *tests.TestApp) string {
+	t.Helper()
+	collection, err := app.Dao().FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := models.NewRecord(collection)
+	record.RefreshId()
+	record.SetUsername("user" + record.Id)
+	record.SetEmail(record.Id + "@example.com")
+	record.SetPassword("1234567890")
+	if err := app.Dao().SaveRecord(record); err != nil {
+		t.Fatal(err)
+	}
+	return record.Id
+}
+
+// newTestDubjob saves a queued dubjob of userID without reserving quota.
+func newTestDubjob(t *testing.T, app *tests.TestApp, userID string, durationSec int) *cmodels.Dubjob {
+	t.Helper()
+	dubjob := &cmodels.Dubjob{
+		User:           userID,
+		Channel:        "test_channel",
+		SourceURL:      "https://example.com/source.mp4",
+		TargetLanguage: "es",
+		DurationSec:    durationSec,
+		MaxAttempts:    cmodels.DefaultDubjobMaxAttempts,
+	}
+	if err := dubjob.SaveDubjob(app); err != nil {
+		t.Fatal(err)
+	}
+	return dubjob
+}
@@ -0,0 +1,154 @@
+package dubbing
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+var errProviderCancelFailed = errors.New("provider cancellation failed")
+
+func handleCancelDubjob(app core.App, ctx echo.Context, env *base.Env, provider DubbingProvider) error {
+	// ==========================
+	// get user
+	user := &cmodels.User{}
+	if err := user.GetUserByContext(ctx); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+
+	dubjob := &cmodels.Dubjob{}
+	if err := dubjob.FindDubjob(app, &cmodels.FindDubjobParams{Id: ctx.PathParam("dubjob_id"), User: user.Id}); err != nil {
+		if err.IsNotFound() {
+			return ctx.JSON(http.StatusNotFound, utils.CError{Message: "Dubjob not found"})
+		}
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+
+	// a finished dub is kept and paid for, only what is left to do is dropped
+	var err *utils.CError
+	if dubjob.Status == cmodels.DubjobDubbed || dubjob.Status == cmodels.DubjobPublishing {
+		err = dropPendingPublish(app, dubjob, "publishing cancelled by user")
+	} else {
+		err = cancelDubjob(app, ctx.Request().Context(), provider, dubjob, "cancelled by user")
+	}
+	if err != nil {
+		if err.IsConflict() {
+			return ctx.JSON(http.StatusConflict, err)
+		}
+		if errors.Is(err.Error, errProviderCancelFailed) {
+			return ctx.JSON(http.StatusBadGateway, err)
+		}
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+	return ctx.JSON(http.StatusOK, dubjob)
+}
+
+// ====================================
+
+// lockDubjobForUpdate takes the lock the queue, the poller and the publisher
+// hold while they work on the dubjob and reloads it, so the caller sees and
+// changes its latest state. The returned unlock func must be called.
+func lockDubjobForUpdate(app core.App, dubjob *cmodels.Dubjob) (func(), *utils.CError) {
+	unlock, ok := tryLockDubjob(dubjob.Id)
+	if !ok {
+		return nil, &utils.CError{
+			Message: "The dubjob is being processed, try again in a moment",
+			Error:   fmt.Errorf("%w: dubjob %s is locked", utils.ErrConflict, dubjob.Id),
+		}
+	}
+	if err := dubjob.FindDubjob(app, &cmodels.FindDubjobParams{Id: dubjob.Id}); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// cancelDubjob stops the dubbing at the provider when it is still running,
+// then cancels the dubjob and refunds its quota in one transaction. Only a
+// dubjob that never delivered a dub can be cancelled, so everything held
+// for it is refunded.
+func cancelDubjob(app core.App, ctx context.Context, provider DubbingProvider, dubjob *cmodels.Dubjob, reason string) *utils.CError {
+	unlock, appErr := lockDubjobForUpdate(app, dubjob)
+	if appErr != nil {
+		return appErr
+	}
+	defer unlock()
+
+	if !cmodels.CanTransitionDubjob(dubjob.Status, cmodels.DubjobCancelled) {
+		return &utils.CError{
+			Message: fmt.Sprintf("A %s dubjob cannot be cancelled", dubjob.Status),
+			Error:   fmt.Errorf("%w: dubjob %s is %s", utils.ErrConflict, dubjob.Id, dubjob.Status),
+		}
+	}
+
+	isRunning := dubjob.Status == cmodels.DubjobSubmitted || dubjob.Status == cmodels.DubjobDubbing
+	if isRunning && dubjob.ExternalID != "" {
+		if err := provider.Cancel(ctx, dubjob.ExternalID); err != nil {
+			return &utils.CError{
+				Message: "The dubbing provider did not accept the cancellation, try again",
+				EventID: err.EventID,
+				Error:   fmt.Errorf("%w: %w", errProviderCancelFailed, err.Error),
+			}
+		}
+	}
+
+	err := app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
+		dubjob.NextAttemptIn = types.DateTime{}
+		if appErr = dubjob.TransitionWithDao(txDao, cmodels.DubjobCancelled, reason); appErr != nil {
+			return appErr.Error
+		}
+		if appErr = refundQuota(txDao, dubjob); appErr != nil {
+			return appErr.Error
+		}
+		return nil
+	})
+	if err != nil {
+		if appErr != nil {
+			return appErr
+		}
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return nil
+}
+
+// dropPendingPublish keeps a finished dub but stops it from being posted:
+// auto-publish is turned off and a publish that did not reach TikTok yet
+// goes back to dubbed. A post TikTok already received can't be recalled.
+func dropPendingPublish(app core.App, dubjob *cmodels.Dubjob, reason string) *utils.CError {
+	unlock, appErr := lockDubjobForUpdate(app, dubjob)
+	if appErr != nil {
+		return appErr
+	}
+	defer unlock()
+
+	switch dubjob.Status {
+	case cmodels.DubjobDubbed:
+		dubjob.AutoPublish = false
+		return dubjob.SaveDubjob(app)
+	case cmodels.DubjobPublishing:
+		if dubjob.PublishID != "" {
+			return &utils.CError{
+				Message: "The dub was already sent to TikTok and can't be recalled",
+				Error:   fmt.Errorf("%w: dubjob %s is being posted as %s", utils.ErrConflict, dubjob.Id, dubjob.PublishID),
+			}
+		}
+		dubjob.AutoPublish = false
+		dubjob.PublishError = ""
+		return dubjob.Transition(app, cmodels.DubjobDubbed, reason)
+	}
+	return &utils.CError{
+		Message: fmt.Sprintf("A %s dubjob cannot be cancelled", dubjob.Status),
+		Error:   fmt.Errorf("%w: dubjob %s is %s", utils.ErrConflict, dubjob.Id, dubjob.Status),
+	}
+}
@@ -0,0 +1,103 @@
+//go:build !goexperiment.jsonv2
+
+package dubbing
+
+import (
+	"basedpocket/cmodels"
+	"context"
+	"testing"
+)
+
+func TestCancelDubjob(t *testing.T) {
+	app := newTestApp(t)
+	userID := newTestUser(t, app)
+	provider := &fakeProvider{}
+
+	dubjob := newTestDubjob(t, app, userID, 60)
+	if err := reserveQuota(app, app.Dao(), dubjob); err != nil {
+		t.Fatal(err)
+	}
+	if err := cancelDubjob(app, context.Background(), provider, dubjob, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if dubjob.Status != cmodels.DubjobCancelled {
+		t.Fatalf("status %s, expected cancelled", dubjob.Status)
+	}
+	if used := usedSeconds(t, app, userID); used != 0 {
+		t.Fatalf("cancel left %d seconds used", used)
+	}
+
+	// cancelled is terminal
+	if err := cancelDubjob(app, context.Background(), provider, dubjob, "test"); err == nil || !err.IsConflict() {
+		t.Fatalf("expected a conflict, got %+v", err)
+	}
+}
+
+func TestCancelDubjobWhileLocked(t *testing.T) {
+	app := newTestApp(t)
+	userID := newTestUser(t, app)
+	dubjob := newTestDubjob(t, app, userID, 60)
+
+	// e.g. the queue is submitting it
+	unlock, _ := tryLockDubjob(dubjob.Id)
+	defer unlock()
+
+	if err := cancelDubjob(app, context.Background(), &fakeProvider{}, dubjob, "test"); err == nil || !err.IsConflict() {
+		t.Fatalf("expected a conflict, got %+v", err)
+	}
+}
+
+func TestDropPendingPublish(t *testing.T) {
+	app := newTestApp(t)
+	userID := newTestUser(t, app)
+
+	moveTo := func(dubjob *cmodels.Dubjob, statuses ...cmodels.DubjobStatus) {
+		t.Helper()
+		for _, status := range statuses {
+			if err := dubjob.Transition(app, status, "test"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	t.Run("dubbed", func(t *testing.T) {
+		dubjob := newTestDubjob(t, app, userID, 60)
+		if err := reserveQuota(app, app.Dao(), dubjob); err != nil {
+			t.Fatal(err)
+		}
+		dubjob.AutoPublish = true
+		moveTo(dubjob, cmodels.DubjobSubmitted, cmodels.DubjobDubbed)
+
+		if err := dropPendingPublish(app, dubjob, "test"); err != nil {
+			t.Fatal(err)
+		}
+		if dubjob.Status != cmodels.DubjobDubbed || dubjob.AutoPublish {
+			t.Fatalf("status %s, auto_publish %v", dubjob.Status, dubjob.AutoPublish)
+		}
+		if used := usedSeconds(t, app, userID); used != 60 {
+			t.Fatalf("a finished dub was refunded, %d seconds used", used)
+		}
+	})
+
+	t.Run("publishing not sent yet", func(t *testing.T) {
+		dubjob := newTestDubjob(t, app, userID, 60)
+		moveTo(dubjob, cmodels.DubjobSubmitted, cmodels.DubjobDubbed, cmodels.DubjobPublishing)
+
+		if err := dropPendingPublish(app, dubjob, "test"); err != nil {
+			t.Fatal(err)
+		}
+		if dubjob.Status != cmodels.DubjobDubbed {
+			t.Fatalf("status %s, expected dubbed", dubjob.Status)
+		}
+	})
+
+	t.Run("publishing sent to tiktok", func(t *testing.T) {
+		dubjob := newTestDubjob(t, app, userID, 60)
+		dubjob.PublishID = "v_pub_url~v2.123"
+		moveTo(dubjob, cmodels.DubjobSubmitted, cmodels.DubjobDubbed, cmodels.DubjobPublishing)
+
+		if err := dropPendingPublish(app, dubjob, "test"); err == nil || !err.IsConflict() {
+			t.Fatalf("expected a conflict, got %+v", err)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package dubbing
+
+import (
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const cleanupJobID string = "dubjobs_cleanup"
+const cleanupSchedule string = "0 3 * * *"
+
+// cleanupLock prevents a slow run from overlapping with the next one.
+var cleanupLock sync.Mutex
+
+// cleanupDubjobs deletes the stored files and the provider-side dubbing of
+// every settled dubjob past its owner's tier retention. The dubjob itself
+// stays as a lightweight history entry, marked with cleaned_in. The source
+// a dub request stored for its children is deleted with the last of them.
+// Every owner gets an event with what was cleaned up for them.
+func cleanupDubjobs(app core.App, provider DubbingProvider) {
+	if !cleanupLock.TryLock() {
+		return
+	}
+	defer cleanupLock.Unlock()
+
+	now := time.Now()
+	dubjobs, err := cmodels.FindCleanableDubjobs(app, now.AddDate(0, 0, -cmodels.MinRetentionDays()))
+	if err != nil {
+		app.Logger().Error("dubjobs cleanup failed", "error", err.Error)
+		return
+	}
+
+	tiers := map[string]int{}
+	perUser := map[string]*cleanupSummary{}
+	cleaned := 0
+	failed := 0
+	var reclaimed int64
+	for _, dubjob := range dubjobs {
+		tier, ok := tiers[dubjob.User]
+		if !ok {
+			if tier, err = findUserTier(app, dubjob.User); err != nil {
+				failed++
+				continue
+			}
+			tiers[dubjob.User] = tier
+		}
+		retention := cmodels.GetTierLimits(tier).RetentionDays
+		if dubjob.StatusChangedIn.Time().After(now.AddDate(0, 0, -retention)) {
+			continue
+		}
+
+		// a publish or cancellation holds the lock while it runs, a dubjob
+		// that moved on meanwhile is left for a later run
+		unlock, ok := tryLockDubjob(dubjob.Id)
+		if !ok {
+			continue
+		}
+		if err := dubjob.FindDubjob(app, &cmodels.FindDubjobParams{Id: dubjob.Id, Status: dubjob.Status}); err != nil {
+			unlock()
+			if !err.IsNotFound() {
+				failed++
+			}
+			continue
+		}
+		size, err := cleanupDubjob(app, provider, dubjob)
+		unlock()
+		reclaimed += size
+		if err != nil {
+			failed++
+			continue
+		}
+		cleaned++
+
+		summary, ok := perUser[dubjob.User]
+		if !ok {
+			summary = &cleanupSummary{}
+			perUser[dubjob.User] = summary
+		}
+		summary.dubjobs++
+		summary.reclaimed += size
+	}
+
+	// an uploaded source shared by a dub request's children goes with the
+	// last of them, one whose deletion failed is tried again on the next run
+	dubRequests, err := cmodels.FindCleanableDubRequests(app)
+	if err != nil {
+		failed++
+	}
+	for _, dubRequest := range dubRequests {
+		size, err := cleanupDubRequestSource(app, dubRequest)
+		reclaimed += size
+		if err != nil {
+			failed++
+			continue
+		}
+		if summary, ok := perUser[dubRequest.User]; ok {
+			summary.reclaimed += size
+		}
+	}
+
+	for userID, summary := range perUser {
+		cmodels.RecordEvent(app, userID, "", cmodels.SecondaryStatus, fmt.Sprintf(
+			"%d dubs past their retention were cleaned up, freeing %.1f MB",
+			summary.dubjobs,
+			float64(summary.reclaimed)/(1024*1024),
+		))
+	}
+
+	app.Logger().Info(
+		"dubjobs cleaned up",
+		"candidates", len(dubjobs),
+		"cleaned", cleaned,
+		"errors", failed,
+		"reclaimed_bytes", reclaimed,
+	)
+}
+
+type cleanupSummary struct {
+	dubjobs   int
+	reclaimed int64
+}
+
+// cleanupDubjob returns the number of bytes it freed, even when it fails
+// part way. Whatever is left is tried again on the next run.
+func cleanupDubjob(app core.App, provider DubbingProvider, dubjob *cmodels.Dubjob) (int64, *utils.CError) {
+	if dubjob.ExternalID != "" && dubjob.Provider == provider.Name() {
+		ctx, cancel := context.WithTimeout(context.Background(), pollerRequestTimeout)
+		err := provider.Delete(ctx, dubjob.ExternalID)
+		cancel()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	size, err := purgeModelFiles(app, dubjob, dubjob.StoredFiles())
+	if err != nil {
+		return size, err
+	}
+
+	dubjob.SourceFile = ""
+	dubjob.OutputFile = ""
+	dubjob.OutputURL = ""
+	dubjob.TranscriptSrt = ""
+	dubjob.TranscriptVtt = ""
+	dubjob.CleanedIn = types.NowDateTime()
+	return size, dubjob.SaveDubjob(app)
+}
+
+// cleanupDubRequestSource deletes the uploaded source a dub request shared
+// with its children, once the last of them was cleaned up.
+func cleanupDubRequestSource(app core.App, dubRequest *cmodels.DubRequest) (int64, *utils.CError) {
+	size, err := purgeModelFiles(app, dubRequest, []string{dubRequest.SourceFile})
+	if err != nil {
+		return size, err
+	}
+
+	dubRequest.SourceFile = ""
+	return size, dubRequest.SaveDubRequest(app)
+}
+
+// purgeModelFiles deletes the named files stored on a dubjob or a dub
+// request and returns their total size. A file that is already gone is
+// skipped.
+func purgeModelFiles(app core.App, m models.Model, names []string) (int64, *utils.CError) {
+	collection, err := app.Dao().FindCollectionByNameOrId(m.TableName())
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return 0, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+
+	fs, err := app.NewFilesystem()
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return 0, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	defer fs.Close()
+
+	var size int64
+	for _, name := range names {
+		fileKey := fmt.Sprintf("%s/%s/%s", collection.BaseFilesPath(), m.GetId(), name)
+		attributes, err := fs.Attributes(fileKey)
+		if err != nil {
+			if exists, _ := fs.Exists(fileKey); !exists {
+				continue
+			}
+			eventID := sentry.CaptureException(err)
+			return size, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+		}
+		if err := fs.Delete(fileKey); err != nil {
+			eventID := sentry.CaptureException(err)
+			return size, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+		}
+		size += attributes.Size
+	}
+	return size, nil
+}
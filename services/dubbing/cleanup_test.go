@@ -0,0 +1,121 @@
+//go:build !goexperiment.jsonv2
+
+package dubbing
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func TestCleanupDubjobsMarksAndRecordsCleanedDubjobs(t *testing.T) {
+	app := newTestApp(t)
+	userID := newTestUser(t, app)
+
+	dubjob := newTestDubjob(t, app, userID, 60)
+	if err := dubjob.Transition(app, cmodels.DubjobFailed, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dubjob.Transition(app, cmodels.DubjobDeadLetter, "test"); err != nil {
+		t.Fatal(err)
+	}
+	changedIn, err := types.ParseDateTime(time.Now().AddDate(-1, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dubjob.StatusChangedIn = changedIn
+	if err := dubjob.SaveDubjob(app); err != nil {
+		t.Fatal(err)
+	}
+
+	cleanupDubjobs(app, &deleteRecordingProvider{})
+
+	if err := dubjob.FindDubjob(app, &cmodels.FindDubjobParams{Id: dubjob.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if !dubjob.IsCleaned() {
+		t.Fatal("the dubjob past its retention was not cleaned")
+	}
+
+	events := []*cmodels.Event{}
+	if err := app.Dao().ModelQuery(&cmodels.Event{}).AndWhere(dbx.HashExp{"user": userID}).All(&events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || !strings.HasPrefix(events[0].Message, "1 dubs past their retention") {
+		t.Fatalf("the cleanup was not recorded as an event: %+v", events)
+	}
+}
+
+func TestCleanupDubjobsDeletesTheSharedSourceWithTheLastChild(t *testing.T) {
+	app := newTestApp(t)
+	userID := newTestUser(t, app)
+
+	dubRequest := &cmodels.DubRequest{
+		User:            userID,
+		Channel:         "test_channel",
+		TargetLanguages: types.JsonArray[string]{"es", "fr"},
+		DurationSec:     60,
+	}
+	children, err := dubRequest.FanOut(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, errFile := filesystem.NewFileFromBytes([]byte("source"), "source.mp4")
+	if errFile != nil {
+		t.Fatal(errFile)
+	}
+	if dubRequest.SourceFile, err = storeSourceFile(app, &base.Env{}, dubRequest, file); err != nil {
+		t.Fatal(err)
+	}
+	if err := dubRequest.SaveDubRequest(app); err != nil {
+		t.Fatal(err)
+	}
+
+	// every child reads the one stored source
+	source, closeSource, err := openSourceMedia(app, children[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, errRead := io.ReadAll(source.File)
+	closeSource()
+	if errRead != nil || string(content) != "source" {
+		t.Fatalf("the child did not read the shared source: %q, %v", content, errRead)
+	}
+
+	changedIn, errParse := types.ParseDateTime(time.Now().AddDate(-1, 0, 0))
+	if errParse != nil {
+		t.Fatal(errParse)
+	}
+	for i, child := range children {
+		if err := child.Transition(app, cmodels.DubjobCancelled, "test"); err != nil {
+			t.Fatal(err)
+		}
+		cleanupDubjobs(app, &deleteRecordingProvider{})
+		if err := dubRequest.FindDubRequest(app, &cmodels.FindDubRequestParams{Id: dubRequest.Id}); err != nil {
+			t.Fatal(err)
+		}
+		if dubRequest.SourceFile == "" {
+			t.Fatalf("the shared source was deleted before child %d was cleaned", i)
+		}
+
+		child.StatusChangedIn = changedIn
+		if err := child.SaveDubjob(app); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cleanupDubjobs(app, &deleteRecordingProvider{})
+	if err := dubRequest.FindDubRequest(app, &cmodels.FindDubRequestParams{Id: dubRequest.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if dubRequest.SourceFile != "" {
+		t.Fatal("the shared source outlived the last child")
+	}
+}
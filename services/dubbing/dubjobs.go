@@ -0,0 +1,204 @@
+package dubbing
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/services/tiktok"
+	"basedpocket/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+const dubjobsPerPage int = 50
+
+// CreateDubjobBody is sent as JSON, or as the "@jsonPayload" part of a
+// multipart/form-data request whose "file" part is the source to dub.
+// A dubjob of an imported video takes its source, duration and, unless
+// given, its channel from the video.
+type CreateDubjobBody struct {
+	Channel        string `json:"channel" validate:"required_without=Video"`
+	Video          string `json:"video"`
+	SourceURL      string `json:"source_url" validate:"omitempty,http_url"`
+	TargetLanguage string `json:"target_language" validate:"required,language"`
+	DurationSec    int    `json:"duration_sec" validate:"required_without=Video,omitempty,min=1,max=14400"`
+	// shadows PublishOptions.AutoPublish, leave it out to use the channel's default
+	AutoPublish *bool `json:"auto_publish"`
+	cmodels.DubbingOptions
+	cmodels.PublishOptions
+}
+
+type DubjobListResponse struct {
+	Page    int               `json:"page"`
+	PerPage int               `json:"per_page"`
+	Items   []*cmodels.Dubjob `json:"items"`
+}
+
+func handleCreateDubjob(app core.App, ctx echo.Context, env *base.Env, provider DubbingProvider, queue *submissionQueue) error {
+	// ==========================
+	// get user
+	user := &cmodels.User{}
+	if err := user.GetUserByContext(ctx); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+
+	body := &CreateDubjobBody{}
+	if err := ctx.Bind(body); err != nil {
+		return ctx.JSON(http.StatusBadRequest, utils.CError{Message: "Invalid request body", Error: err})
+	}
+	if err := validate.Struct(body); err != nil {
+		return ctx.JSON(http.StatusBadRequest, utils.CError{Message: err.Error(), Error: err})
+	}
+	if err := checkProviderLanguages(provider, body.TargetLanguage); err != nil {
+		return ctx.JSON(http.StatusBadRequest, err)
+	}
+
+	// ==========================
+	// the source is either a public URL, an uploaded file or an imported video
+	source, status, appErr := resolveDubSource(app, ctx, env, user.Id, body.SourceURL, body.Video, body.DurationSec)
+	if appErr != nil {
+		return ctx.JSON(status, appErr)
+	}
+	if source.Video != nil && body.Channel == "" {
+		body.Channel = source.Video.Channel
+	}
+	if err := checkClip(body.DubbingOptions, source.DurationSec); err != nil {
+		return ctx.JSON(http.StatusBadRequest, err)
+	}
+
+	// ==========================
+	// channel must belong to the user
+	channel := &cmodels.Channel{}
+	if err := channel.FindChannel(app, &cmodels.FindChannelParams{Id: body.Channel, User: user.Id}); err != nil {
+		if err.IsNotFound() {
+			return ctx.JSON(http.StatusNotFound, utils.CError{Message: "Channel not found"})
+		}
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+
+	dubjob := &cmodels.Dubjob{
+		User:           user.Id,
+		Channel:        channel.Id,
+		Video:          body.Video,
+		SourceURL:      source.URL,
+		TargetLanguage: body.TargetLanguage,
+		DurationSec:    source.DurationSec,
+		DubbingOptions: body.DubbingOptions,
+		PublishOptions: body.PublishOptions,
+	}
+	dubjob.AutoPublish = resolveAutoPublish(body.AutoPublish, channel)
+	if err := createDubjob(app, env, dubjob, source.File); err != nil {
+		return ctx.JSON(quotaErrorStatus(err), err)
+	}
+	queue.Notify()
+
+	return ctx.JSON(http.StatusOK, dubjob)
+}
+
+func handleListDubjobs(app core.App, ctx echo.Context, env *base.Env) error {
+	// ==========================
+	// get user
+	user := &cmodels.User{}
+	if err := user.GetUserByContext(ctx); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+
+	page, errPage := strconv.Atoi(ctx.QueryParamDefault("page", "1"))
+	if errPage != nil || page < 1 {
+		return ctx.JSON(http.StatusBadRequest, utils.CError{Message: "Invalid page"})
+	}
+
+	dubjobs, err := cmodels.FindDubjobs(app, &cmodels.FindDubjobParams{
+		User:       user.Id,
+		Channel:    ctx.QueryParam("channel"),
+		DubRequest: ctx.QueryParam("dub_request"),
+		Status:     cmodels.DubjobStatus(ctx.QueryParam("status")),
+	}, dubjobsPerPage, (page-1)*dubjobsPerPage)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+
+	return ctx.JSON(http.StatusOK, DubjobListResponse{Page: page, PerPage: dubjobsPerPage, Items: dubjobs})
+}
+
+// checkClip rejects a start_time or end_time outside of a source of
+// durationSec seconds.
+func checkClip(options cmodels.DubbingOptions, durationSec int) *utils.CError {
+	if options.EndTime > durationSec {
+		return &utils.CError{Message: "end_time is past the end of the source"}
+	}
+	if options.StartTime > 0 && options.StartTime >= durationSec {
+		return &utils.CError{Message: "start_time is past the end of the source"}
+	}
+	return nil
+}
+
+// findSourceVideo loads the user's imported video and refreshes it from its
+// platform, so the dubjob uses its current share URL and duration.
+func findSourceVideo(app core.App, ctx echo.Context, env *base.Env, userID string, videoID string) (*cmodels.Video, int, *utils.CError) {
+	video := &cmodels.Video{}
+	if err := video.FindVideo(app, &cmodels.FindVideoParams{Id: videoID, User: userID}); err != nil {
+		if err.IsNotFound() {
+			return nil, http.StatusNotFound, &utils.CError{Message: "Video not found"}
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	if err := tiktok.RefreshVideo(app, ctx.Request().Context(), env, video); err != nil {
+		if err.IsNotFound() {
+			return nil, http.StatusNotFound, &utils.CError{Message: "The video is no longer available on TikTok"}
+		}
+		return nil, http.StatusBadGateway, err
+	}
+	if video.ShareURL == "" || video.DurationSec < 1 {
+		return nil, http.StatusUnprocessableEntity, &utils.CError{Message: "The video can't be dubbed"}
+	}
+	return video, 0, nil
+}
+
+// ====================================
+
+// createDubjob persists a new queued dubjob, stores its uploaded source if
+// any and reserves its quota in a single transaction. Nothing is kept when
+// the quota is exceeded or the database fails. The submission queue hands
+// the dubjob to the provider afterwards.
+func createDubjob(app core.App, env *base.Env, dubjob *cmodels.Dubjob, sourceFile *filesystem.File) *utils.CError {
+	dubjob.Status = cmodels.DubjobQueued
+	dubjob.MaxAttempts = cmodels.DefaultDubjobMaxAttempts
+
+	var appErr *utils.CError
+	err := app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
+		if err := txDao.Save(dubjob); err != nil {
+			return err
+		}
+		if sourceFile != nil {
+			if dubjob.SourceFile, appErr = storeSourceFile(app, env, dubjob, sourceFile); appErr != nil {
+				return appErr.Error
+			}
+			if err := txDao.Save(dubjob); err != nil {
+				return err
+			}
+		}
+		if appErr = reserveQuota(app, txDao, dubjob); appErr != nil {
+			return appErr.Error
+		}
+		return nil
+	})
+	if err == nil {
+		return nil
+	}
+
+	if dubjob.SourceFile != "" {
+		deleteModelFile(app, dubjob, dubjob.SourceFile)
+	}
+	dubjob.MarkAsNew()
+	if appErr != nil {
+		return appErr
+	}
+	eventID := sentry.CaptureException(err)
+	return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+}
@@ -0,0 +1,156 @@
+package dubbing
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"net/http"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// CreateDubRequestBody takes the same sources as CreateDubjobBody: a public
+// URL, the "file" part of a multipart/form-data request or an imported video.
+type CreateDubRequestBody struct {
+	Channel         string   `json:"channel" validate:"required_without=Video"`
+	Video           string   `json:"video"`
+	SourceURL       string   `json:"source_url" validate:"omitempty,http_url"`
+	TargetLanguages []string `json:"target_languages" validate:"required,min=1,max=10,unique,dive,required,language"`
+	DurationSec     int      `json:"duration_sec" validate:"required_without=Video,omitempty,min=1,max=14400"`
+	// shadows PublishOptions.AutoPublish, leave it out to use the channel's default
+	AutoPublish *bool `json:"auto_publish"`
+	cmodels.DubbingOptions
+	cmodels.PublishOptions
+}
+
+type DubRequestResponse struct {
+	DubRequest *cmodels.DubRequest `json:"dub_request"`
+	Dubjobs    []*cmodels.Dubjob   `json:"dubjobs"`
+}
+
+func handleCreateDubRequest(app core.App, ctx echo.Context, env *base.Env, provider DubbingProvider, queue *submissionQueue) error {
+	// ==========================
+	// get user
+	user := &cmodels.User{}
+	if err := user.GetUserByContext(ctx); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+
+	body := &CreateDubRequestBody{}
+	if err := ctx.Bind(body); err != nil {
+		return ctx.JSON(http.StatusBadRequest, utils.CError{Message: "Invalid request body", Error: err})
+	}
+	if err := validate.Struct(body); err != nil {
+		return ctx.JSON(http.StatusBadRequest, utils.CError{Message: err.Error(), Error: err})
+	}
+	if err := checkProviderLanguages(provider, body.TargetLanguages...); err != nil {
+		return ctx.JSON(http.StatusBadRequest, err)
+	}
+
+	// ==========================
+	// the source is either a public URL, an uploaded file or an imported video
+	source, status, appErr := resolveDubSource(app, ctx, env, user.Id, body.SourceURL, body.Video, body.DurationSec)
+	if appErr != nil {
+		return ctx.JSON(status, appErr)
+	}
+	if source.Video != nil && body.Channel == "" {
+		body.Channel = source.Video.Channel
+	}
+	if err := checkClip(body.DubbingOptions, source.DurationSec); err != nil {
+		return ctx.JSON(http.StatusBadRequest, err)
+	}
+
+	// ==========================
+	// channel must belong to the user
+	channel := &cmodels.Channel{}
+	if err := channel.FindChannel(app, &cmodels.FindChannelParams{Id: body.Channel, User: user.Id}); err != nil {
+		if err.IsNotFound() {
+			return ctx.JSON(http.StatusNotFound, utils.CError{Message: "Channel not found"})
+		}
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+
+	// ==========================
+	// fan out into one dubjob per language
+	dubRequest := &cmodels.DubRequest{
+		User:            user.Id,
+		Channel:         channel.Id,
+		Video:           body.Video,
+		SourceURL:       source.URL,
+		TargetLanguages: types.JsonArray[string](body.TargetLanguages),
+		DurationSec:     source.DurationSec,
+		DubbingOptions:  body.DubbingOptions,
+		PublishOptions:  body.PublishOptions,
+	}
+	dubRequest.AutoPublish = resolveAutoPublish(body.AutoPublish, channel)
+
+	// every language is billed, so the whole fan-out has to fit in the quota.
+	// an uploaded source is stored once on the dub request and read from
+	// there by every child
+	err := app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
+		var dubjobs []*cmodels.Dubjob
+		if dubjobs, appErr = dubRequest.FanOutWithDao(txDao); appErr != nil {
+			return appErr.Error
+		}
+		if source.File != nil {
+			if dubRequest.SourceFile, appErr = storeSourceFile(app, env, dubRequest, source.File); appErr != nil {
+				return appErr.Error
+			}
+			if err := txDao.Save(dubRequest); err != nil {
+				return err
+			}
+		}
+		for _, dubjob := range dubjobs {
+			if appErr = reserveQuota(app, txDao, dubjob); appErr != nil {
+				return appErr.Error
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if dubRequest.SourceFile != "" {
+			deleteModelFile(app, dubRequest, dubRequest.SourceFile)
+		}
+		if appErr == nil {
+			eventID := sentry.CaptureException(err)
+			appErr = &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+		}
+		return ctx.JSON(quotaErrorStatus(appErr), appErr)
+	}
+
+	queue.Notify()
+
+	return respondDubRequest(app, ctx, dubRequest.Id, user.Id)
+}
+
+func handleGetDubRequest(app core.App, ctx echo.Context, env *base.Env) error {
+	// ==========================
+	// get user
+	user := &cmodels.User{}
+	if err := user.GetUserByContext(ctx); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+
+	return respondDubRequest(app, ctx, ctx.PathParam("dub_request_id"), user.Id)
+}
+
+func respondDubRequest(app core.App, ctx echo.Context, dubRequestID string, userID string) error {
+	dubRequest := &cmodels.DubRequest{}
+	if err := dubRequest.FindDubRequest(app, &cmodels.FindDubRequestParams{Id: dubRequestID, User: userID}); err != nil {
+		if err.IsNotFound() {
+			return ctx.JSON(http.StatusNotFound, utils.CError{Message: "Dub request not found"})
+		}
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+
+	dubjobs, err := dubRequest.FindDubjobs(app)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+
+	return ctx.JSON(http.StatusOK, DubRequestResponse{DubRequest: dubRequest, Dubjobs: dubjobs})
+}
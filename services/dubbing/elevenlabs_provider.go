@@ -0,0 +1,98 @@
+package dubbing
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/services/elevenlabs"
+	"basedpocket/utils"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+var _ DubbingProvider = (*elevenlabsProvider)(nil)
+
+type elevenlabsProvider struct {
+	env *base.Env
+}
+
+func (p *elevenlabsProvider) Name() string {
+	return ElevenlabsProviderName
+}
+
+func (p *elevenlabsProvider) Submit(ctx context.Context, dubjob *cmodels.Dubjob, source *SourceMedia) (*ProviderSubmission, *utils.CError) {
+	res, err := elevenlabs.CreateDubbing(ctx, p.env, &elevenlabs.CreateDubbingParams{
+		SourceURL:           source.URL,
+		SourceFile:          source.File,
+		SourceFileName:      source.FileName,
+		SourceLanguage:      dubjob.SourceLanguage,
+		TargetLanguage:      dubjob.TargetLanguage,
+		NumSpeakers:         dubjob.NumSpeakers,
+		Watermark:           dubjob.Watermark,
+		StartTime:           dubjob.StartTime,
+		EndTime:             dubjob.EndTime,
+		HighestResolution:   dubjob.HighestResolution,
+		DropBackgroundAudio: dubjob.DropBackgroundAudio,
+	})
+	if elevenlabs.IsRateLimited(err) {
+		return nil, &utils.CError{Message: err.Message, EventID: err.EventID, Error: fmt.Errorf("%w: %w", errProviderRateLimited, err.Error)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// expected_duration_sec estimates the processing time, not the length of
+	// the media, so the quota stays held for the declared or probed length
+	return &ProviderSubmission{
+		ExternalID:       res.DubbingID,
+		ExpectedDuration: time.Second * time.Duration(res.ExpectedDurationSec),
+	}, nil
+}
+
+func (p *elevenlabsProvider) Status(ctx context.Context, externalID string) (*ProviderStatus, *utils.CError) {
+	res, err := elevenlabs.GetDubbing(ctx, p.env, externalID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch res.Status {
+	case elevenlabs.DubbingStatusDubbing:
+		return &ProviderStatus{State: ProviderDubbing}, nil
+	case elevenlabs.DubbingStatusDubbed:
+		return &ProviderStatus{State: ProviderDubbed}, nil
+	case elevenlabs.DubbingStatusFailed:
+		return &ProviderStatus{State: ProviderFailed, Error: res.Error}, nil
+	}
+
+	errStatus := fmt.Errorf("unhandled elevenlabs dubbing status: %s | dubbing: %s", res.Status, externalID)
+	eventID := sentry.CaptureException(errStatus)
+	return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: errStatus}
+}
+
+func (p *elevenlabsProvider) Download(ctx context.Context, externalID string, languageCode string, w io.Writer) (int64, *utils.CError) {
+	return elevenlabs.DownloadDubbedFile(ctx, p.env, externalID, languageCode, w)
+}
+
+func (p *elevenlabsProvider) Transcript(ctx context.Context, externalID string, languageCode string, format TranscriptFormat, w io.Writer) (int64, *utils.CError) {
+	formatType := elevenlabs.TranscriptFormatSrt
+	if format == TranscriptVtt {
+		formatType = elevenlabs.TranscriptFormatWebvtt
+	}
+	return elevenlabs.DownloadTranscript(ctx, p.env, externalID, languageCode, formatType, w)
+}
+
+func (p *elevenlabsProvider) Cancel(ctx context.Context, externalID string) *utils.CError {
+	return elevenlabs.DeleteDubbing(ctx, p.env, externalID)
+}
+
+// Delete treats a dubbing that is already gone, e.g. after a cancellation,
+// as deleted.
+func (p *elevenlabsProvider) Delete(ctx context.Context, externalID string) *utils.CError {
+	err := elevenlabs.DeleteDubbing(ctx, p.env, externalID)
+	if elevenlabs.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
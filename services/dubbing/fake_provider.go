@@ -0,0 +1,106 @@
+package dubbing
+
+import (
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// fakeFailMarker makes the fake provider fail a dubbing whose source URL
+// contains it, so the failure path can be exercised on purpose.
+const fakeFailMarker string = "fake-fail"
+const fakeDubbingDuration time.Duration = time.Minute
+
+var _ DubbingProvider = (*fakeProvider)(nil)
+
+// fakeProvider is a deterministic, in-process provider for tests, local
+// dev and CI. It keeps no state: everything it needs to answer a status
+// call is encoded in the external ID it hands out on submit.
+type fakeProvider struct{}
+
+func (p *fakeProvider) Name() string {
+	return FakeProviderName
+}
+
+func (p *fakeProvider) Submit(ctx context.Context, dubjob *cmodels.Dubjob, source *SourceMedia) (*ProviderSubmission, *utils.CError) {
+	outcome := "ok"
+	if strings.Contains(source.URL, fakeFailMarker) || strings.Contains(source.FileName, fakeFailMarker) {
+		outcome = "fail"
+	}
+	return &ProviderSubmission{
+		ExternalID:       fmt.Sprintf("fake_%d_%s_%s", time.Now().Unix(), outcome, dubjob.Id),
+		ExpectedDuration: fakeDubbingDuration,
+	}, nil
+}
+
+func (p *fakeProvider) Status(ctx context.Context, externalID string) (*ProviderStatus, *utils.CError) {
+	submittedAt, outcome, err := parseFakeExternalID(externalID)
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(submittedAt) < fakeDubbingDuration {
+		return &ProviderStatus{State: ProviderDubbing}, nil
+	}
+	if outcome == "fail" {
+		return &ProviderStatus{State: ProviderFailed, Error: "fake provider failure"}, nil
+	}
+	return &ProviderStatus{State: ProviderDubbed}, nil
+}
+
+func (p *fakeProvider) Download(ctx context.Context, externalID string, languageCode string, w io.Writer) (int64, *utils.CError) {
+	n, err := io.WriteString(w, fmt.Sprintf("fake dubbed media | %s | %s\n", externalID, languageCode))
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return int64(n), &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return int64(n), nil
+}
+
+func (p *fakeProvider) Transcript(ctx context.Context, externalID string, languageCode string, format TranscriptFormat, w io.Writer) (int64, *utils.CError) {
+	transcript := fmt.Sprintf("1\n00:00:00,000 --> 00:00:05,000\nfake transcript | %s | %s\n", externalID, languageCode)
+	if format == TranscriptVtt {
+		transcript = fmt.Sprintf("WEBVTT\n\n00:00:00.000 --> 00:00:05.000\nfake transcript | %s | %s\n", externalID, languageCode)
+	}
+	n, err := io.WriteString(w, transcript)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return int64(n), &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return int64(n), nil
+}
+
+func (p *fakeProvider) Cancel(ctx context.Context, externalID string) *utils.CError {
+	if _, _, err := parseFakeExternalID(externalID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *fakeProvider) Delete(ctx context.Context, externalID string) *utils.CError {
+	if _, _, err := parseFakeExternalID(externalID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func parseFakeExternalID(externalID string) (time.Time, string, *utils.CError) {
+	parts := strings.SplitN(externalID, "_", 4)
+	if len(parts) != 4 || parts[0] != "fake" {
+		err := fmt.Errorf("invalid fake external id: %s", externalID)
+		eventID := sentry.CaptureException(err)
+		return time.Time{}, "", &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	unix, errParse := strconv.ParseInt(parts[1], 10, 64)
+	if errParse != nil {
+		eventID := sentry.CaptureException(errParse)
+		return time.Time{}, "", &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: errParse}
+	}
+	return time.Unix(unix, 0), parts[2], nil
+}
@@ -0,0 +1,63 @@
+package dubbing
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"fmt"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+var validate = newValidator()
+
+// newValidator adds a "language" tag that only accepts codes of the
+// language registry.
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterValidation("language", func(fl validator.FieldLevel) bool {
+		return cmodels.IsLanguage(fl.Field().String())
+	})
+	return v
+}
+
+// checkProviderLanguages rejects target languages the provider cannot dub
+// into, before anything is saved or sent.
+func checkProviderLanguages(provider DubbingProvider, codes ...string) *utils.CError {
+	for _, code := range codes {
+		language, _ := cmodels.GetLanguage(code)
+		if !language.SupportsProvider(provider.Name()) {
+			return &utils.CError{Message: fmt.Sprintf("Dubbing into %q is not supported", code)}
+		}
+	}
+	return nil
+}
+
+// ====================================
+
+type LanguageListResponse struct {
+	Items []cmodels.Language `json:"items"`
+}
+
+// handleListLanguages lists the language registry for language pickers,
+// optionally narrowed to a provider and/or a platform.
+func handleListLanguages(app core.App, ctx echo.Context, env *base.Env) error {
+	provider := ctx.QueryParam("provider")
+	platform := ctx.QueryParam("platform")
+
+	items := []cmodels.Language{}
+	for _, language := range cmodels.GetLanguages() {
+		if provider != "" && !language.SupportsProvider(provider) {
+			continue
+		}
+		if platform != "" && !language.SupportsPlatform(platform) {
+			continue
+		}
+		items = append(items, language)
+	}
+
+	return ctx.JSON(http.StatusOK, LanguageListResponse{Items: items})
+}
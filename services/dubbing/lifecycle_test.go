@@ -0,0 +1,84 @@
+//go:build !goexperiment.jsonv2
+
+package dubbing
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+)
+
+func TestFakeDubjobFromQueuedToDubbed(t *testing.T) {
+	app := newTestApp(t)
+	userID := newTestUser(t, app)
+	env := &base.Env{DOMAIN: "http://localhost:8090"}
+	provider := &fakeProvider{}
+	queue := newSubmissionQueue(app, provider)
+
+	dubjob := &cmodels.Dubjob{
+		User:           userID,
+		Channel:        "test_channel",
+		SourceURL:      "https://example.com/source.mp4",
+		TargetLanguage: "es",
+		DurationSec:    90,
+	}
+	if err := createDubjob(app, env, dubjob, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	queue.dispatch()
+	if err := dubjob.FindDubjob(app, &cmodels.FindDubjobParams{Id: dubjob.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if dubjob.Status != cmodels.DubjobSubmitted || !strings.HasPrefix(dubjob.ExternalID, "fake_") {
+		t.Fatalf("the dubjob was not submitted: %s %q", dubjob.Status, dubjob.ExternalID)
+	}
+
+	if err := pollDubjob(app, env, provider, dubjob); err != nil {
+		t.Fatal(err)
+	}
+	if dubjob.Status != cmodels.DubjobDubbing {
+		t.Fatalf("the dubjob is %s while the provider is dubbing", dubjob.Status)
+	}
+
+	// the fake provider finishes a minute after the submission encoded in
+	// the external ID
+	dubjob.ExternalID = fmt.Sprintf("fake_%d_ok_%s", time.Now().Add(-fakeDubbingDuration-time.Second).Unix(), dubjob.Id)
+	if err := dubjob.SaveDubjob(app); err != nil {
+		t.Fatal(err)
+	}
+	if err := pollDubjob(app, env, provider, dubjob); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dubjob.FindDubjob(app, &cmodels.FindDubjobParams{Id: dubjob.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if dubjob.Status != cmodels.DubjobDubbed || dubjob.OutputFile == "" || dubjob.TranscriptSrt == "" || dubjob.TranscriptVtt == "" {
+		t.Fatalf("the dubjob was not completed: %+v", dubjob)
+	}
+	if used := usedSeconds(t, app, userID); used != 90 {
+		t.Fatalf("used %d seconds, expected 90", used)
+	}
+
+	transitions := []*cmodels.DubjobTransition{}
+	err := app.Dao().ModelQuery(&cmodels.DubjobTransition{}).
+		AndWhere(dbx.HashExp{"dubjob": dubjob.Id}).
+		OrderBy("rowid ASC").
+		All(&transitions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := []cmodels.DubjobStatus{}
+	for _, transition := range transitions {
+		path = append(path, transition.ToStatus)
+	}
+	if fmt.Sprint(path) != fmt.Sprint([]cmodels.DubjobStatus{cmodels.DubjobSubmitted, cmodels.DubjobDubbing, cmodels.DubjobDubbed}) {
+		t.Fatalf("unexpected transitions: %v", path)
+	}
+}
@@ -0,0 +1,166 @@
+package dubbing
+
+import (
+	"basedpocket/base"
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func LoadDubbing(app *pocketbase.PocketBase, env *base.Env) {
+
+	provider := NewProvider(env)
+
+	app.OnBeforeServe().Add(func(e *core.ServeEvent) error {
+		queue := newSubmissionQueue(e.App, provider)
+
+		// ===================
+		// routes
+		e.Router.AddRoute(echo.Route{
+			Method: http.MethodPost,
+			Path:   "/dubjobs",
+			Handler: func(c echo.Context) error {
+				return handleCreateDubjob(e.App, c, env, provider, queue)
+			},
+			Middlewares: []echo.MiddlewareFunc{
+				apis.ActivityLogger(e.App),
+				apis.RequireRecordAuth("users"),
+			},
+		})
+
+		e.Router.AddRoute(echo.Route{
+			Method: http.MethodGet,
+			Path:   "/dubjobs",
+			Handler: func(c echo.Context) error {
+				return handleListDubjobs(e.App, c, env)
+			},
+			Middlewares: []echo.MiddlewareFunc{
+				apis.ActivityLogger(e.App),
+				apis.RequireRecordAuth("users"),
+			},
+		})
+
+		e.Router.AddRoute(echo.Route{
+			Method: http.MethodPost,
+			Path:   "/dubjobs/:dubjob_id/cancel",
+			Handler: func(c echo.Context) error {
+				return handleCancelDubjob(e.App, c, env, provider)
+			},
+			Middlewares: []echo.MiddlewareFunc{
+				apis.ActivityLogger(e.App),
+				apis.RequireRecordAuth("users"),
+			},
+		})
+
+		e.Router.AddRoute(echo.Route{
+			Method: http.MethodGet,
+			Path:   "/dubjobs/:dubjob_id/transcript",
+			Handler: func(c echo.Context) error {
+				return handleDownloadTranscript(e.App, c, env)
+			},
+			Middlewares: []echo.MiddlewareFunc{
+				apis.ActivityLogger(e.App),
+				apis.RequireRecordAuth("users"),
+			},
+		})
+
+		e.Router.AddRoute(echo.Route{
+			Method: http.MethodPost,
+			Path:   "/dub-requests",
+			Handler: func(c echo.Context) error {
+				return handleCreateDubRequest(e.App, c, env, provider, queue)
+			},
+			Middlewares: []echo.MiddlewareFunc{
+				apis.ActivityLogger(e.App),
+				apis.RequireRecordAuth("users"),
+			},
+		})
+
+		e.Router.AddRoute(echo.Route{
+			Method: http.MethodGet,
+			Path:   "/dub-requests/:dub_request_id",
+			Handler: func(c echo.Context) error {
+				return handleGetDubRequest(e.App, c, env)
+			},
+			Middlewares: []echo.MiddlewareFunc{
+				apis.ActivityLogger(e.App),
+				apis.RequireRecordAuth("users"),
+			},
+		})
+
+		e.Router.AddRoute(echo.Route{
+			Method: http.MethodGet,
+			Path:   "/languages",
+			Handler: func(c echo.Context) error {
+				return handleListLanguages(e.App, c, env)
+			},
+			Middlewares: []echo.MiddlewareFunc{
+				apis.ActivityLogger(e.App),
+			},
+		})
+
+		e.Router.AddRoute(echo.Route{
+			Method: http.MethodGet,
+			Path:   "/usage",
+			Handler: func(c echo.Context) error {
+				return handleGetUsage(e.App, c, env)
+			},
+			Middlewares: []echo.MiddlewareFunc{
+				apis.ActivityLogger(e.App),
+				apis.RequireRecordAuth("users"),
+			},
+		})
+
+		e.Router.AddRoute(echo.Route{
+			Method: http.MethodGet,
+			Path:   "/admin/dubjobs/dead-letter",
+			Handler: func(c echo.Context) error {
+				return handleListDeadLetterDubjobs(e.App, c, env)
+			},
+			Middlewares: []echo.MiddlewareFunc{
+				apis.ActivityLogger(e.App),
+				apis.RequireAdminAuth(),
+			},
+		})
+
+		e.Router.AddRoute(echo.Route{
+			Method: http.MethodPost,
+			Path:   "/admin/dubjobs/:dubjob_id/requeue",
+			Handler: func(c echo.Context) error {
+				return handleRequeueDubjob(e.App, c, env, queue)
+			},
+			Middlewares: []echo.MiddlewareFunc{
+				apis.ActivityLogger(e.App),
+				apis.RequireAdminAuth(),
+			},
+		})
+
+		e.Router.AddRoute(echo.Route{
+			Method: http.MethodPost,
+			Path:   "/webhooks/elevenlabs",
+			Handler: func(c echo.Context) error {
+				return handleElevenlabsWebhook(e.App, c, env, provider)
+			},
+			Middlewares: []echo.MiddlewareFunc{
+				apis.ActivityLogger(e.App),
+			},
+		})
+
+		// ===================
+		// workers
+		queue.Start()
+		poller := startPoller(e.App, env, provider, queue)
+		go reconcileDubjobs(e.App, env, provider, queue)
+
+		app.OnTerminate().Add(func(e *core.TerminateEvent) error {
+			poller.Stop()
+			queue.Stop()
+			return nil
+		})
+
+		return nil
+	})
+}
@@ -0,0 +1,184 @@
+package dubbing
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/tools/cron"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const pollerJobID string = "dubjobs_poller"
+const pollerSchedule string = "* * * * *"
+const pollerRequestTimeout time.Duration = 30 * time.Second
+
+// webhookGracePeriod is how long past its expected_ready_in a dubjob is left
+// to its webhook before the poller reconciles it.
+const webhookGracePeriod time.Duration = 10 * time.Minute
+
+// pollerLock prevents a slow run from overlapping with the next tick.
+var pollerLock sync.Mutex
+
+// dubjobLocks holds the ids of the dubjobs whose provider status is being
+// applied, so the poller and the webhook never store the same output twice.
+var dubjobLocks sync.Map
+
+func tryLockDubjob(id string) (func(), bool) {
+	if _, loaded := dubjobLocks.LoadOrStore(id, struct{}{}); loaded {
+		return nil, false
+	}
+	return func() { dubjobLocks.Delete(id) }, true
+}
+
+// usesWebhook reports whether the provider pushes completions to us, in
+// which case polling is only a fallback for missed webhooks.
+func usesWebhook(env *base.Env, provider DubbingProvider) bool {
+	return provider.Name() == ElevenlabsProviderName && env.ELEVENLABS_WEBHOOK_SECRET != ""
+}
+
+func startPoller(app core.App, env *base.Env, provider DubbingProvider, queue *submissionQueue) *cron.Cron {
+	scheduler := cron.New()
+	scheduler.MustAdd(pollerJobID, pollerSchedule, func() {
+		pollDueDubjobs(app, env, provider)
+	})
+	scheduler.MustAdd(retrierJobID, pollerSchedule, func() {
+		retryDueDubjobs(app, env, queue)
+	})
+	scheduler.MustAdd(publisherJobID, pollerSchedule, func() {
+		publishDueDubjobs(app, env)
+	})
+	scheduler.MustAdd(cleanupJobID, cleanupSchedule, func() {
+		cleanupDubjobs(app, provider)
+	})
+	scheduler.Start()
+	return scheduler
+}
+
+// ====================================
+
+func pollDueDubjobs(app core.App, env *base.Env, provider DubbingProvider) {
+	if !pollerLock.TryLock() {
+		return
+	}
+	defer pollerLock.Unlock()
+
+	dueBefore := time.Now()
+	if usesWebhook(env, provider) {
+		dueBefore = dueBefore.Add(-webhookGracePeriod)
+	}
+	dubjobs, err := cmodels.FindDueDubjobs(app, dueBefore)
+	if err != nil {
+		return
+	}
+
+	for _, dubjob := range dubjobs {
+		// jobs of a previously configured provider cannot be tracked by this one
+		if dubjob.Provider != "" && dubjob.Provider != provider.Name() {
+			continue
+		}
+		pollDubjob(app, env, provider, dubjob)
+	}
+}
+
+func pollDubjob(app core.App, env *base.Env, provider DubbingProvider, dubjob *cmodels.Dubjob) *utils.CError {
+	ctx, cancel := context.WithTimeout(context.Background(), pollerRequestTimeout)
+	defer cancel()
+
+	res, err := provider.Status(ctx, dubjob.ExternalID)
+	if err != nil {
+		return err
+	}
+	return applyProviderStatus(app, env, provider, dubjob, res)
+}
+
+// applyProviderStatus advances a submitted or dubbing dubjob to match the
+// provider's status. It is shared by the poller and the provider webhook.
+func applyProviderStatus(app core.App, env *base.Env, provider DubbingProvider, dubjob *cmodels.Dubjob, res *ProviderStatus) *utils.CError {
+	unlock, ok := tryLockDubjob(dubjob.Id)
+	if !ok {
+		// already being handled
+		return nil
+	}
+	defer unlock()
+
+	// reload, the other side may have handled it while we were waiting on the provider
+	if err := dubjob.FindDubjob(app, &cmodels.FindDubjobParams{Id: dubjob.Id}); err != nil {
+		return err
+	}
+	if dubjob.Status != cmodels.DubjobSubmitted && dubjob.Status != cmodels.DubjobDubbing {
+		return nil
+	}
+
+	switch res.State {
+	case ProviderDubbed:
+		// a failed download leaves the job due, so the next tick retries it.
+		// transcripts go first as they are cheap to fetch again
+		if err := storeDubbedTranscripts(app, env, provider, dubjob); err != nil {
+			return err
+		}
+		if err := storeDubbedOutput(app, env, provider, dubjob); err != nil {
+			return err
+		}
+		dubjob.ErrorMessage = ""
+		dubjob.FinishedIn = types.NowDateTime()
+		if err := completeDubjob(app, dubjob); err != nil {
+			return err
+		}
+		if dubjob.AutoPublish {
+			dubjob.PublishAttempts = 0
+			return dubjob.Transition(app, cmodels.DubjobPublishing, "auto publish")
+		}
+		return nil
+	case ProviderFailed:
+		dubjob.ErrorMessage = res.Error
+		if dubjob.ErrorMessage == "" {
+			dubjob.ErrorMessage = "dubbing failed"
+		}
+		dubjob.FinishedIn = types.NowDateTime()
+		return failDubjob(app.Dao(), dubjob, dubjob.ErrorMessage)
+	case ProviderDubbing:
+		// still in progress, check again on the next tick
+		if dubjob.Status == cmodels.DubjobSubmitted {
+			return dubjob.Transition(app, cmodels.DubjobDubbing, "provider started dubbing")
+		}
+		return nil
+	default:
+		err := fmt.Errorf("unhandled provider state: %s | dubjob: %s", res.State, dubjob.Id)
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+}
+
+// completeDubjob moves a dubjob whose output is stored to dubbed. The quota
+// held for it is settled to the measured length of the output, the work is
+// done at that point so an overage is charged even past the quota.
+func completeDubjob(app core.App, dubjob *cmodels.Dubjob) *utils.CError {
+	var appErr *utils.CError
+	err := app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
+		if dubjob.OutputDurationSec > 0 {
+			if appErr = settleQuota(app, txDao, dubjob, dubjob.OutputDurationSec, true); appErr != nil {
+				return appErr.Error
+			}
+		}
+		if appErr = dubjob.TransitionWithDao(txDao, cmodels.DubjobDubbed, "dubbing completed"); appErr != nil {
+			return appErr.Error
+		}
+		return nil
+	})
+	if err != nil {
+		if appErr != nil {
+			return appErr
+		}
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return nil
+}
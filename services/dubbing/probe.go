@@ -0,0 +1,166 @@
+package dubbing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// maxProbeBoxes bounds the boxes or chunks read while looking for the
+// duration, so a malformed file can't keep the probe busy.
+const maxProbeBoxes int = 1024
+
+// probeMediaDuration reads the duration of MP4, QuickTime and WAV media
+// from their headers, rounded up to whole seconds. It reports false for
+// other formats or when no duration is found, the caller then has to
+// rely on another source for it.
+func probeMediaDuration(r io.ReadSeeker) (int, bool) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, false
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, false
+	}
+
+	switch {
+	case bytes.Equal(header[4:8], []byte("ftyp")), bytes.Equal(header[4:8], []byte("moov")), bytes.Equal(header[4:8], []byte("wide")), bytes.Equal(header[4:8], []byte("mdat")):
+		return probeMP4Duration(r)
+	case bytes.Equal(header[0:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WAVE")):
+		return probeWAVDuration(r)
+	}
+	return 0, false
+}
+
+// probeMP4Duration finds the movie header box (moov/mvhd) of an ISO base
+// media file and divides its duration by its timescale.
+func probeMP4Duration(r io.ReadSeeker) (int, bool) {
+	moovSize, ok := findMP4Box(r, "moov", -1)
+	if !ok {
+		return 0, false
+	}
+	mvhdSize, ok := findMP4Box(r, "mvhd", moovSize)
+	if !ok || mvhdSize < 4 {
+		return 0, false
+	}
+
+	versionAndFlags := make([]byte, 4)
+	if _, err := io.ReadFull(r, versionAndFlags); err != nil {
+		return 0, false
+	}
+	var timescale uint32
+	var duration uint64
+	if versionAndFlags[0] == 1 {
+		// creation and modification time are 64 bit in version 1
+		fields := make([]byte, 28)
+		if _, err := io.ReadFull(r, fields); err != nil {
+			return 0, false
+		}
+		timescale = binary.BigEndian.Uint32(fields[16:20])
+		duration = binary.BigEndian.Uint64(fields[20:28])
+	} else {
+		fields := make([]byte, 16)
+		if _, err := io.ReadFull(r, fields); err != nil {
+			return 0, false
+		}
+		timescale = binary.BigEndian.Uint32(fields[8:12])
+		duration = uint64(binary.BigEndian.Uint32(fields[12:16]))
+	}
+	if timescale == 0 || duration == 0 || duration == math.MaxUint32 || duration == math.MaxUint64 {
+		return 0, false
+	}
+	return secondsCeil(duration, uint64(timescale))
+}
+
+// findMP4Box walks the boxes from the current offset, for at most limit
+// bytes or to the end when limit is negative, and stops at the start of
+// the content of the first box named name. It returns the content size.
+func findMP4Box(r io.ReadSeeker, name string, limit int64) (int64, bool) {
+	header := make([]byte, 8)
+	for i := 0; i < maxProbeBoxes && (limit < 0 || limit >= 8); i++ {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return 0, false
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		headerSize := int64(8)
+		if size == 1 {
+			large := make([]byte, 8)
+			if _, err := io.ReadFull(r, large); err != nil {
+				return 0, false
+			}
+			size = int64(binary.BigEndian.Uint64(large))
+			headerSize = 16
+		}
+		if size == 0 {
+			// the box runs to the end of the file
+			if string(header[4:8]) == name {
+				return math.MaxInt64, true
+			}
+			return 0, false
+		}
+		if size < headerSize || (limit >= 0 && size > limit) {
+			return 0, false
+		}
+		if string(header[4:8]) == name {
+			return size - headerSize, true
+		}
+		if _, err := r.Seek(size-headerSize, io.SeekCurrent); err != nil {
+			return 0, false
+		}
+		if limit >= 0 {
+			limit -= size
+		}
+	}
+	return 0, false
+}
+
+// probeWAVDuration divides the size of the data chunk by the byte rate of
+// the fmt chunk.
+func probeWAVDuration(r io.ReadSeeker) (int, bool) {
+	if _, err := r.Seek(12, io.SeekStart); err != nil {
+		return 0, false
+	}
+
+	var byteRate uint32
+	header := make([]byte, 8)
+	for i := 0; i < maxProbeBoxes; i++ {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return 0, false
+		}
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+		switch string(header[0:4]) {
+		case "fmt ":
+			if size < 16 {
+				return 0, false
+			}
+			format := make([]byte, 16)
+			if _, err := io.ReadFull(r, format); err != nil {
+				return 0, false
+			}
+			byteRate = binary.LittleEndian.Uint32(format[8:12])
+			size -= 16
+		case "data":
+			if byteRate == 0 || size == 0 {
+				return 0, false
+			}
+			return secondsCeil(uint64(size), uint64(byteRate))
+		}
+		// chunks are padded to an even size
+		if _, err := r.Seek(size+size%2, io.SeekCurrent); err != nil {
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+func secondsCeil(units uint64, perSecond uint64) (int, bool) {
+	seconds := units / perSecond
+	if units%perSecond != 0 {
+		seconds++
+	}
+	if seconds > math.MaxInt32 {
+		return 0, false
+	}
+	return int(seconds), true
+}
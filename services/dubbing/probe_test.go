@@ -0,0 +1,83 @@
+package dubbing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func mp4Box(name string, content []byte) []byte {
+	box := make([]byte, 8, 8+len(content))
+	binary.BigEndian.PutUint32(box[0:4], uint32(8+len(content)))
+	copy(box[4:8], name)
+	return append(box, content...)
+}
+
+func mvhdV0(timescale uint32, duration uint32) []byte {
+	content := make([]byte, 20)
+	binary.BigEndian.PutUint32(content[12:16], timescale)
+	binary.BigEndian.PutUint32(content[16:20], duration)
+	return mp4Box("mvhd", content)
+}
+
+func mvhdV1(timescale uint32, duration uint64) []byte {
+	content := make([]byte, 32)
+	content[0] = 1
+	binary.BigEndian.PutUint32(content[20:24], timescale)
+	binary.BigEndian.PutUint64(content[24:32], duration)
+	return mp4Box("mvhd", content)
+}
+
+func wav(byteRate uint32, dataSize uint32) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("RIFF")
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	buf.WriteString("WAVE")
+	// an odd sized chunk before fmt, padded to an even size
+	buf.WriteString("LIST")
+	binary.Write(buf, binary.LittleEndian, uint32(3))
+	buf.Write([]byte{0, 0, 0, 0})
+	buf.WriteString("fmt ")
+	binary.Write(buf, binary.LittleEndian, uint32(16))
+	format := make([]byte, 16)
+	binary.LittleEndian.PutUint32(format[8:12], byteRate)
+	buf.Write(format)
+	buf.WriteString("data")
+	binary.Write(buf, binary.LittleEndian, dataSize)
+	return buf.Bytes()
+}
+
+func TestProbeMediaDuration(t *testing.T) {
+	ftyp := mp4Box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2mp41"))
+	mdat := mp4Box("mdat", make([]byte, 64))
+
+	tests := []struct {
+		name     string
+		media    []byte
+		expected int
+		ok       bool
+	}{
+		{"mp4 v0", concat(ftyp, mdat, mp4Box("moov", mvhdV0(1000, 90500))), 91, true},
+		{"mp4 v1", concat(ftyp, mp4Box("moov", concat(mvhdV1(600, 36000)))), 60, true},
+		{"mvhd after other boxes", concat(ftyp, mp4Box("moov", concat(mp4Box("iods", make([]byte, 8)), mvhdV0(1, 12)))), 12, true},
+		{"mp4 without moov", concat(ftyp, mdat), 0, false},
+		{"mp4 with zero timescale", concat(ftyp, mp4Box("moov", mvhdV0(0, 100))), 0, false},
+		{"truncated mp4", concat(ftyp, mp4Box("moov", mvhdV0(1000, 5000)))[:len(ftyp)+20], 0, false},
+		{"wav", wav(176400, 176400*30+1), 31, true},
+		{"wav without fmt", wav(0, 1000), 0, false},
+		{"unknown format", []byte("ID3\x04\x00\x00\x00\x00\x00\x00\x00\x00\x00"), 0, false},
+		{"too short", []byte("RIFF"), 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			seconds, ok := probeMediaDuration(bytes.NewReader(test.media))
+			if seconds != test.expected || ok != test.ok {
+				t.Errorf("got %d, %v, expected %d, %v", seconds, ok, test.expected, test.ok)
+			}
+		})
+	}
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
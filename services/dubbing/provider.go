@@ -0,0 +1,69 @@
+package dubbing
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+)
+
+// errProviderRateLimited is wrapped in Submit errors when the provider asks
+// us to slow down. The submission is retried later instead of failing.
+var errProviderRateLimited = errors.New("dubbing provider rate limited")
+
+// DubbingProvider is the external service that does the actual dubbing.
+// The dubbing flow only talks to providers through this interface.
+type DubbingProvider interface {
+	Name() string
+	Submit(ctx context.Context, dubjob *cmodels.Dubjob, source *SourceMedia) (*ProviderSubmission, *utils.CError)
+	Status(ctx context.Context, externalID string) (*ProviderStatus, *utils.CError)
+	Download(ctx context.Context, externalID string, languageCode string, w io.Writer) (int64, *utils.CError)
+	Transcript(ctx context.Context, externalID string, languageCode string, format TranscriptFormat, w io.Writer) (int64, *utils.CError)
+	Cancel(ctx context.Context, externalID string) *utils.CError
+	// Delete removes a finished dubbing and its media from the provider.
+	Delete(ctx context.Context, externalID string) *utils.CError
+}
+
+type ProviderSubmission struct {
+	ExternalID       string
+	ExpectedDuration time.Duration
+	// the length of the source as the provider measured it, 0 when the
+	// provider does not tell
+	MediaDurationSec int
+}
+
+type ProviderState string
+
+const ProviderDubbing ProviderState = "dubbing"
+const ProviderDubbed ProviderState = "dubbed"
+const ProviderFailed ProviderState = "failed"
+
+type ProviderStatus struct {
+	State ProviderState
+	Error string
+}
+
+type TranscriptFormat string
+
+const TranscriptSrt TranscriptFormat = "srt"
+const TranscriptVtt TranscriptFormat = "vtt"
+
+// ====================================
+
+const ElevenlabsProviderName string = cmodels.ElevenlabsProvider
+const FakeProviderName string = cmodels.FakeProvider
+
+func NewProvider(env *base.Env) DubbingProvider {
+	switch env.DUBBING_PROVIDER {
+	case ElevenlabsProviderName:
+		return &elevenlabsProvider{env: env}
+	case FakeProviderName:
+		return &fakeProvider{}
+	}
+	log.Fatalf("unknown dubbing provider: %s", env.DUBBING_PROVIDER)
+	return nil
+}
@@ -0,0 +1,219 @@
+package dubbing
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/services/tiktok"
+	"basedpocket/utils"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const publisherJobID string = "dubjobs_publisher"
+
+// maxPublishAttempts bounds the posts started for one publish before the
+// dubjob goes back to dubbed.
+const maxPublishAttempts int = 3
+
+// publisherLock prevents a slow run from overlapping with the next tick.
+var publisherLock sync.Mutex
+
+// resolveAutoPublish is the dubjob's own choice when it made one, or else
+// the default of its channel.
+func resolveAutoPublish(choice *bool, channel *cmodels.Channel) bool {
+	if choice != nil {
+		return *choice
+	}
+	return channel.AutoPublish
+}
+
+// publishDueDubjobs drives every publishing dubjob one step: the post is
+// started on the owning TikTok channel, then tracked until TikTok reports
+// it as published or failed.
+func publishDueDubjobs(app core.App, env *base.Env) {
+	if !publisherLock.TryLock() {
+		return
+	}
+	defer publisherLock.Unlock()
+
+	dubjobs, err := cmodels.FindDubjobsByStatus(app, cmodels.DubjobPublishing)
+	if err != nil {
+		return
+	}
+
+	for _, dubjob := range dubjobs {
+		publishDubjob(app, dubjob)
+	}
+}
+
+func publishDubjob(app core.App, dubjob *cmodels.Dubjob) *utils.CError {
+	// a cancellation holds the lock while it runs
+	unlock, ok := tryLockDubjob(dubjob.Id)
+	if !ok {
+		return nil
+	}
+	defer unlock()
+	if err := dubjob.FindDubjob(app, &cmodels.FindDubjobParams{Id: dubjob.Id, Status: cmodels.DubjobPublishing}); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pollerRequestTimeout)
+	defer cancel()
+	if dubjob.PublishID == "" {
+		return startPublish(app, ctx, dubjob)
+	}
+	return trackPublish(app, ctx, dubjob)
+}
+
+// startPublish starts a FILE_UPLOAD post of the dubjob's output, so it
+// works without a verified domain. The upload runs in the background and
+// trackPublish follows the post from then on.
+func startPublish(app core.App, ctx context.Context, dubjob *cmodels.Dubjob) *utils.CError {
+	accessToken, reason, err := findPublishAccessToken(app, dubjob)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return failPublish(app, dubjob, reason)
+	}
+	if dubjob.OutputFile == "" || dubjob.IsCleaned() {
+		return failPublish(app, dubjob, "the dub is no longer stored")
+	}
+	if dubjob.OutputSize <= 0 || dubjob.OutputSize > tiktok.MaxVideoSize {
+		return failPublish(app, dubjob, "the dub is empty or too large for tiktok")
+	}
+
+	res, err := tiktok.InitVideoPublishFromFile(ctx, accessToken, dubjob.OutputSize, tiktok.PostInfo{
+		Title:              dubjob.PublishTitle,
+		PrivacyLevel:       tiktok.PrivacyLevel(dubjob.GetPublishPrivacyLevel()),
+		DisableComment:     dubjob.PublishDisableComment,
+		DisableDuet:        dubjob.PublishDisableDuet,
+		DisableStitch:      dubjob.PublishDisableStitch,
+		BrandContentToggle: dubjob.PublishBrandContent,
+		BrandOrganicToggle: dubjob.PublishBrandOrganic,
+		// a dub is AI-generated content and has to be labelled as such
+		IsAigc: true,
+	})
+	if err != nil {
+		return retryPublish(app, dubjob, err.Error.Error())
+	}
+
+	video, _, err := openModelFile(app, dubjob, dubjob.OutputFile)
+	if err != nil {
+		return err
+	}
+	dubjob.PublishID = res.Data.PublishID
+	dubjob.PublishError = ""
+	if err := dubjob.SaveDubjob(app); err != nil {
+		video.Close()
+		return err
+	}
+
+	publishID := res.Data.PublishID
+	tiktok.StartVideoUpload(res.Data.UploadURL, video, dubjob.OutputSize, func(uploadErr *utils.CError) {
+		// only the post that is still tracked is retried
+		failed := &cmodels.Dubjob{}
+		if err := failed.FindDubjob(app, &cmodels.FindDubjobParams{Id: dubjob.Id, Status: cmodels.DubjobPublishing, PublishID: publishID}); err != nil {
+			return
+		}
+		retryPublish(app, failed, uploadErr.Error.Error())
+	})
+	return nil
+}
+
+func trackPublish(app core.App, ctx context.Context, dubjob *cmodels.Dubjob) *utils.CError {
+	accessToken, reason, err := findPublishAccessToken(app, dubjob)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return failPublish(app, dubjob, reason)
+	}
+
+	// a failed status call is tried again on the next tick
+	res, err := tiktok.FetchPublishStatus(ctx, accessToken, dubjob.PublishID)
+	if err != nil {
+		return err
+	}
+
+	switch res.Data.Status {
+	case tiktok.PublishComplete:
+		if len(res.Data.PubliclyAvailablePostIDs) > 0 {
+			dubjob.PostID = strconv.FormatInt(res.Data.PubliclyAvailablePostIDs[0], 10)
+		}
+		dubjob.PublishedIn = types.NowDateTime()
+		return dubjob.Transition(app, cmodels.DubjobPublished, "published on tiktok")
+	case tiktok.PublishFailed:
+		return retryPublish(app, dubjob, res.Data.FailReason)
+	}
+	return nil
+}
+
+// retryPublish records why the post failed and leaves the dubjob
+// publishing without a post, so the next tick starts a new one. After
+// maxPublishAttempts failed posts it gives up with failPublish.
+func retryPublish(app core.App, dubjob *cmodels.Dubjob, reason string) *utils.CError {
+	if reason == "" {
+		reason = "publishing failed"
+	}
+	dubjob.PublishAttempts++
+	if dubjob.PublishAttempts >= maxPublishAttempts {
+		return failPublish(app, dubjob, fmt.Sprintf("%s, gave up after %d attempts", reason, dubjob.PublishAttempts))
+	}
+	dubjob.PublishID = ""
+	dubjob.PublishError = reason
+	return dubjob.SaveDubjob(app)
+}
+
+// failPublish records why the post failed, tells the user with an event and
+// moves the dubjob back to dubbed, which keeps the dub and lets the user
+// publish it again.
+func failPublish(app core.App, dubjob *cmodels.Dubjob, reason string) *utils.CError {
+	if reason == "" {
+		reason = "publishing failed"
+	}
+	dubjob.PublishID = ""
+	dubjob.PublishError = reason
+	if err := dubjob.Transition(app, cmodels.DubjobDubbed, "publishing failed"); err != nil {
+		return err
+	}
+	cmodels.RecordEvent(app, dubjob.User, dubjob.Channel, cmodels.ErrorStatus, fmt.Sprintf("Publishing a dub to TikTok failed: %s", reason))
+	return nil
+}
+
+// findPublishAccessToken returns the access token of the dubjob's channel,
+// or the reason it can't be published to.
+func findPublishAccessToken(app core.App, dubjob *cmodels.Dubjob) (string, string, *utils.CError) {
+	channel := &cmodels.Channel{}
+	if err := channel.FindChannel(app, &cmodels.FindChannelParams{Id: dubjob.Channel}); err != nil {
+		return "", "", err
+	}
+	platform := &cmodels.Platform{}
+	if err := platform.FindPlatform(app, &cmodels.FindPlatformParams{Id: channel.Platform}); err != nil {
+		return "", "", err
+	}
+	if platform.Name != cmodels.TikTokPlatform {
+		return "", "publishing is only supported on tiktok channels", nil
+	}
+	if channel.NeedsReauth {
+		return "", "the channel needs to be reconnected", nil
+	}
+
+	oauth := &cmodels.OAuth{}
+	if err := oauth.FindOAuth(app, &cmodels.FindOAuthParams{Channel: channel.Id}); err != nil {
+		if err.IsNotFound() {
+			return "", "the channel is not connected", nil
+		}
+		return "", "", err
+	}
+	if oauth.AccessTokenExpiresIn == nil || oauth.AccessTokenExpiresIn.Time().Before(time.Now()) {
+		return "", "the channel needs to be reconnected", nil
+	}
+	return oauth.AccessToken, "", nil
+}
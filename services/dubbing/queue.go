@@ -0,0 +1,154 @@
+package dubbing
+
+import (
+	"basedpocket/cmodels"
+	"errors"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// maxActiveDubjobs caps the dubjobs running at the provider at once, across
+// all users. maxActiveDubjobsPerUser keeps one user from taking all of them.
+const maxActiveDubjobs int = 10
+const maxActiveDubjobsPerUser int = 3
+
+const queueTickInterval time.Duration = 10 * time.Second
+const queueBatchSize int = 100
+const rateLimitBaseDelay time.Duration = 30 * time.Second
+const rateLimitMaxDelay time.Duration = 10 * time.Minute
+
+// submissionQueue submits queued dubjobs to the provider from a single
+// goroutine, so the concurrency caps hold no matter how many users submit
+// at once. The queue itself is the queued dubjobs in the database, which
+// makes it survive restarts.
+type submissionQueue struct {
+	app      core.App
+	provider DubbingProvider
+	wake     chan struct{}
+	stop     chan struct{}
+
+	// only touched by the queue goroutine
+	rateLimitedUntil time.Time
+	rateLimitStreak  int
+}
+
+func newSubmissionQueue(app core.App, provider DubbingProvider) *submissionQueue {
+	return &submissionQueue{
+		app:      app,
+		provider: provider,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+func (q *submissionQueue) Start() {
+	go func() {
+		ticker := time.NewTicker(queueTickInterval)
+		defer ticker.Stop()
+		for {
+			q.dispatch()
+			select {
+			case <-q.stop:
+				return
+			case <-q.wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (q *submissionQueue) Stop() {
+	close(q.stop)
+}
+
+// Notify wakes the queue up after dubjobs were queued. It never blocks.
+func (q *submissionQueue) Notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ====================================
+
+// dispatch submits queued dubjobs in priority order for as long as the
+// caps allow. A 429 from the provider pauses the whole queue with backoff,
+// the dubjob stays queued and keeps its attempts.
+func (q *submissionQueue) dispatch() {
+	if time.Now().Before(q.rateLimitedUntil) {
+		return
+	}
+
+	perUser, total, err := cmodels.CountActiveDubjobs(q.app)
+	if err != nil {
+		return
+	}
+	if total >= maxActiveDubjobs {
+		return
+	}
+
+	dubjobs, err := cmodels.FindQueuedDubjobs(q.app, queueBatchSize)
+	if err != nil {
+		return
+	}
+
+	for _, dubjob := range dubjobs {
+		if total >= maxActiveDubjobs {
+			return
+		}
+		if perUser[dubjob.User] >= maxActiveDubjobsPerUser {
+			continue
+		}
+
+		// a cancellation holds the lock while it runs
+		unlock, ok := tryLockDubjob(dubjob.Id)
+		if !ok {
+			continue
+		}
+		// it may have been cancelled since it was listed
+		if err := dubjob.FindDubjob(q.app, &cmodels.FindDubjobParams{Id: dubjob.Id, Status: cmodels.DubjobQueued}); err != nil {
+			unlock()
+			continue
+		}
+
+		err := submitDubjob(q.app, q.app.Dao(), q.provider, dubjob)
+		unlock()
+
+		if err != nil && errors.Is(err.Error, errProviderRateLimited) {
+			q.rateLimitStreak++
+			q.rateLimitedUntil = time.Now().Add(rateLimitDelay(q.rateLimitStreak))
+			return
+		}
+		q.rateLimitStreak = 0
+		if err != nil && errors.Is(err.Error, errQuotaExceeded) {
+			if err := rejectDubjob(q.app.Dao(), dubjob, err.Message); err != nil {
+				q.app.Logger().Error("rejecting a dubjob failed", "dubjob", dubjob.Id, "error", err.Error)
+			}
+			continue
+		}
+		if err != nil && !err.IsConflict() {
+			if err := failDubjob(q.app.Dao(), dubjob, "submission to the dubbing provider failed"); err != nil {
+				q.app.Logger().Error("failing a dubjob failed", "dubjob", dubjob.Id, "error", err.Error)
+			}
+			continue
+		}
+		if err != nil {
+			// cancelled while it was being submitted
+			continue
+		}
+		perUser[dubjob.User]++
+		total++
+	}
+}
+
+func rateLimitDelay(streak int) time.Duration {
+	delay := rateLimitMaxDelay
+	if streak < 16 {
+		delay = rateLimitBaseDelay << (streak - 1)
+	}
+	if delay <= 0 || delay > rateLimitMaxDelay {
+		delay = rateLimitMaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,209 @@
+package dubbing
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+)
+
+var errQuotaExceeded = errors.New("monthly dubbing quota exceeded")
+
+type UsageResponse struct {
+	Period           string `json:"period"`
+	Tier             int    `json:"tier"`
+	QuotaSeconds     int    `json:"quota_seconds"`
+	UsedSeconds      int    `json:"used_seconds"`
+	RemainingSeconds int    `json:"remaining_seconds"`
+}
+
+func handleGetUsage(app core.App, ctx echo.Context, env *base.Env) error {
+	// ==========================
+	// get user
+	user := &cmodels.User{}
+	if err := user.GetUserByContext(ctx); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+
+	usage, err := getUsage(app, app.Dao(), user.Id, time.Now())
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+	return ctx.JSON(http.StatusOK, usage)
+}
+
+// ====================================
+
+// findUserTier returns the tier of the user's subscription, or the free
+// tier 0 when there is none.
+func findUserTier(app core.App, userID string) (int, *utils.CError) {
+	customer := &cmodels.Customer{}
+	if err := customer.FindCustomer(app, &cmodels.FindCustomerParams{User: userID}); err != nil {
+		if err.IsNotFound() {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return customer.Tier, nil
+}
+
+// getUsage reads the user's tier and the usage ledger of the period now is in.
+// Pass a transaction dao to see reservations that are not committed yet.
+func getUsage(app core.App, dao *daos.Dao, userID string, now time.Time) (*UsageResponse, *utils.CError) {
+	tier, err := findUserTier(app, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	period := cmodels.UsagePeriod(now)
+	used, err := cmodels.SumUsageSeconds(dao, userID, period)
+	if err != nil {
+		return nil, err
+	}
+
+	quota := cmodels.GetTierLimits(tier).MonthlyDubSeconds
+	remaining := quota - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &UsageResponse{
+		Period:           period,
+		Tier:             tier,
+		QuotaSeconds:     quota,
+		UsedSeconds:      used,
+		RemainingSeconds: remaining,
+	}, nil
+}
+
+// reserveQuota books the dubjob's duration against the current period, or
+// rejects it with errQuotaExceeded when it does not fit in what is left.
+func reserveQuota(app core.App, dao *daos.Dao, dubjob *cmodels.Dubjob) *utils.CError {
+	usage, err := getUsage(app, dao, dubjob.User, time.Now())
+	if err != nil {
+		return err
+	}
+	seconds := dubjob.BilledSeconds(dubjob.DurationSec)
+	if seconds > usage.RemainingSeconds {
+		return &utils.CError{
+			Message: fmt.Sprintf("Monthly dubbing quota exceeded: %d seconds requested, %d of %d seconds remaining", seconds, usage.RemainingSeconds, usage.QuotaSeconds),
+			Error:   errQuotaExceeded,
+		}
+	}
+
+	entry := &cmodels.Usage{
+		User:    dubjob.User,
+		Dubjob:  dubjob.Id,
+		Period:  usage.Period,
+		Kind:    cmodels.UsageReserve,
+		Seconds: seconds,
+	}
+	return entry.SaveUsageWithDao(dao)
+}
+
+// settleQuota corrects what is held for the dubjob to billedSeconds, the
+// length of the dubbed media as measured once it is known. A shortfall is
+// refunded. An overage is charged against the current period, or rejected
+// with errQuotaExceeded when it does not fit in what is left and
+// allowOverage is false; nothing is written then.
+func settleQuota(app core.App, dao *daos.Dao, dubjob *cmodels.Dubjob, billedSeconds int, allowOverage bool) *utils.CError {
+	held, err := cmodels.SumDubjobUsageByPeriod(dao, dubjob.Id)
+	if err != nil {
+		return err
+	}
+	heldSeconds := 0
+	for _, seconds := range held {
+		heldSeconds += seconds
+	}
+	diff := billedSeconds - heldSeconds
+	if diff == 0 {
+		return nil
+	}
+
+	// a shortfall is given back in the periods it is held in, so no period
+	// ever holds less than nothing for the dubjob
+	for period, seconds := range held {
+		if diff >= 0 {
+			break
+		}
+		if seconds <= 0 {
+			continue
+		}
+		refund := seconds
+		if -diff < refund {
+			refund = -diff
+		}
+		entry := &cmodels.Usage{
+			User:    dubjob.User,
+			Dubjob:  dubjob.Id,
+			Period:  period,
+			Kind:    cmodels.UsageAdjust,
+			Seconds: -refund,
+		}
+		if err := entry.SaveUsageWithDao(dao); err != nil {
+			return err
+		}
+		diff += refund
+	}
+	if diff <= 0 {
+		return nil
+	}
+
+	usage, err := getUsage(app, dao, dubjob.User, time.Now())
+	if err != nil {
+		return err
+	}
+	if diff > usage.RemainingSeconds && !allowOverage {
+		return &utils.CError{
+			Message: fmt.Sprintf("Monthly dubbing quota exceeded: the source is %d seconds longer than declared, %d of %d seconds remaining", diff, usage.RemainingSeconds, usage.QuotaSeconds),
+			Error:   errQuotaExceeded,
+		}
+	}
+
+	entry := &cmodels.Usage{
+		User:    dubjob.User,
+		Dubjob:  dubjob.Id,
+		Period:  usage.Period,
+		Kind:    cmodels.UsageAdjust,
+		Seconds: diff,
+	}
+	return entry.SaveUsageWithDao(dao)
+}
+
+// refundQuota gives back everything still held for the dubjob, in the
+// periods it was reserved in.
+func refundQuota(dao *daos.Dao, dubjob *cmodels.Dubjob) *utils.CError {
+	held, err := cmodels.SumDubjobUsageByPeriod(dao, dubjob.Id)
+	if err != nil {
+		return err
+	}
+	for period, seconds := range held {
+		if seconds <= 0 {
+			continue
+		}
+		entry := &cmodels.Usage{
+			User:    dubjob.User,
+			Dubjob:  dubjob.Id,
+			Period:  period,
+			Kind:    cmodels.UsageRefund,
+			Seconds: -seconds,
+		}
+		if err := entry.SaveUsageWithDao(dao); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func quotaErrorStatus(err *utils.CError) int {
+	if errors.Is(err.Error, errQuotaExceeded) {
+		return http.StatusPaymentRequired
+	}
+	return http.StatusInternalServerError
+}
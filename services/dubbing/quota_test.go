@@ -0,0 +1,140 @@
+//go:build !goexperiment.jsonv2
+
+package dubbing
+
+import (
+	"basedpocket/cmodels"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+func usedSeconds(t *testing.T, app *tests.TestApp, userID string) int {
+	t.Helper()
+	usage, err := getUsage(app, app.Dao(), userID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return usage.UsedSeconds
+}
+
+func TestReserveQuota(t *testing.T) {
+	app := newTestApp(t)
+	userID := newTestUser(t, app)
+	free := cmodels.GetTierLimits(0).MonthlyDubSeconds
+
+	first := newTestDubjob(t, app, userID, free-60)
+	if err := reserveQuota(app, app.Dao(), first); err != nil {
+		t.Fatal(err)
+	}
+	if used := usedSeconds(t, app, userID); used != free-60 {
+		t.Fatalf("used %d, expected %d", used, free-60)
+	}
+
+	second := newTestDubjob(t, app, userID, 61)
+	err := reserveQuota(app, app.Dao(), second)
+	if err == nil || !errors.Is(err.Error, errQuotaExceeded) {
+		t.Fatalf("expected errQuotaExceeded, got %+v", err)
+	}
+	if used := usedSeconds(t, app, userID); used != free-60 {
+		t.Fatalf("a rejected reservation was booked, used %d", used)
+	}
+
+	clipped := newTestDubjob(t, app, userID, 600)
+	clipped.StartTime = 100
+	clipped.EndTime = 160
+	if err := reserveQuota(app, app.Dao(), clipped); err != nil {
+		t.Fatal(err)
+	}
+	if used := usedSeconds(t, app, userID); used != free {
+		t.Fatalf("only the clip should be booked, used %d", used)
+	}
+}
+
+func TestRefundQuota(t *testing.T) {
+	app := newTestApp(t)
+	userID := newTestUser(t, app)
+
+	dubjob := newTestDubjob(t, app, userID, 120)
+	if err := reserveQuota(app, app.Dao(), dubjob); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := refundQuota(app.Dao(), dubjob); err != nil {
+			t.Fatal(err)
+		}
+		if used := usedSeconds(t, app, userID); used != 0 {
+			t.Fatalf("refund %d left %d seconds used", i+1, used)
+		}
+	}
+}
+
+func TestSettleQuota(t *testing.T) {
+	free := cmodels.GetTierLimits(0).MonthlyDubSeconds
+
+	tests := []struct {
+		name         string
+		declared     int
+		measured     int
+		allowOverage bool
+		expectedUsed int
+		exceeded     bool
+	}{
+		{"matches", 100, 100, false, 100, false},
+		{"shorter is refunded", 100, 60, false, 60, false},
+		{"longer within quota is charged", 100, 150, false, 150, false},
+		{"longer past quota fails", 100, free + 1, false, 100, true},
+		{"longer past quota is charged when allowed", 100, free + 1, true, free + 1, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApp(t)
+			userID := newTestUser(t, app)
+			dubjob := newTestDubjob(t, app, userID, test.declared)
+			if err := reserveQuota(app, app.Dao(), dubjob); err != nil {
+				t.Fatal(err)
+			}
+
+			err := settleQuota(app, app.Dao(), dubjob, test.measured, test.allowOverage)
+			if test.exceeded != (err != nil && errors.Is(err.Error, errQuotaExceeded)) {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if used := usedSeconds(t, app, userID); used != test.expectedUsed {
+				t.Fatalf("used %d, expected %d", used, test.expectedUsed)
+			}
+
+			// whatever was settled, a refund gives all of it back
+			if err := refundQuota(app.Dao(), dubjob); err != nil {
+				t.Fatal(err)
+			}
+			if used := usedSeconds(t, app, userID); used != 0 {
+				t.Fatalf("refund left %d seconds used", used)
+			}
+		})
+	}
+}
+
+func TestSettleQuotaRefundsInTheReservedPeriod(t *testing.T) {
+	app := newTestApp(t)
+	userID := newTestUser(t, app)
+	dubjob := newTestDubjob(t, app, userID, 100)
+
+	// reserved last month, settled this month
+	entry := &cmodels.Usage{User: userID, Dubjob: dubjob.Id, Period: "2000-01", Kind: cmodels.UsageReserve, Seconds: 100}
+	if err := entry.SaveUsageWithDao(app.Dao()); err != nil {
+		t.Fatal(err)
+	}
+	if err := settleQuota(app, app.Dao(), dubjob, 40, false); err != nil {
+		t.Fatal(err)
+	}
+
+	held, err := cmodels.SumDubjobUsageByPeriod(app.Dao(), dubjob.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(held) != 1 || held["2000-01"] != 40 {
+		t.Fatalf("unexpected holdings: %v", held)
+	}
+}
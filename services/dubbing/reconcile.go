@@ -0,0 +1,129 @@
+package dubbing
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"context"
+	"fmt"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+type reconcileSummary struct {
+	Queued  int
+	Tracked int
+	// running jobs without a provider job, failed so the retrier picks them up
+	Lost    int
+	Skipped int
+	Errors  int
+}
+
+func (s *reconcileSummary) add(other *reconcileSummary) {
+	s.Queued += other.Queued
+	s.Tracked += other.Tracked
+	s.Lost += other.Lost
+	s.Skipped += other.Skipped
+	s.Errors += other.Errors
+}
+
+// reconcileDubjobs runs once on start and picks up the dubjobs that were in
+// flight when the process stopped. Running jobs are re-queried at the
+// provider and brought up to date, running jobs that lost their provider job
+// are failed so they get retried, and queued jobs, including those saved
+// right before a crash, are handed to the submission queue. Failed and
+// dead-lettered jobs are left to the retrier and the admins. Every user with
+// a dubjob in flight gets an event with the counts of theirs.
+func reconcileDubjobs(app core.App, env *base.Env, provider DubbingProvider, queue *submissionQueue) {
+	// keep the poller off the same jobs until this is done
+	pollerLock.Lock()
+	defer pollerLock.Unlock()
+
+	dubjobs, err := cmodels.FindDubjobsByStatus(app, cmodels.DubjobQueued, cmodels.DubjobSubmitted, cmodels.DubjobDubbing)
+	if err != nil {
+		app.Logger().Error("dubjobs reconciliation failed", "error", err.Error)
+		return
+	}
+
+	perUser := map[string]*reconcileSummary{}
+	for _, dubjob := range dubjobs {
+		summary, ok := perUser[dubjob.User]
+		if !ok {
+			summary = &reconcileSummary{}
+			perUser[dubjob.User] = summary
+		}
+
+		switch {
+		case dubjob.Status == cmodels.DubjobQueued:
+			summary.Queued++
+		case dubjob.Provider != "" && dubjob.Provider != provider.Name():
+			summary.Skipped++
+		case dubjob.ExternalID == "":
+			if err := failDubjob(app.Dao(), dubjob, "provider job lost on restart"); err != nil {
+				summary.Errors++
+				continue
+			}
+			summary.Lost++
+		default:
+			if err := reconcileRunningDubjob(app, env, provider, dubjob); err != nil {
+				summary.Errors++
+				continue
+			}
+			summary.Tracked++
+		}
+	}
+	queue.Notify()
+
+	total := reconcileSummary{}
+	for userID, summary := range perUser {
+		total.add(summary)
+
+		status := cmodels.SecondaryStatus
+		if summary.Lost > 0 || summary.Errors > 0 {
+			status = cmodels.WarningStatus
+		}
+		cmodels.RecordEvent(app, userID, "", status, fmt.Sprintf(
+			"%d dubs in progress were picked up after a restart: %d queued, %d tracked, %d failed after losing their provider job, %d skipped, %d errors",
+			summary.Queued+summary.Tracked+summary.Lost+summary.Skipped+summary.Errors,
+			summary.Queued,
+			summary.Tracked,
+			summary.Lost,
+			summary.Skipped,
+			summary.Errors,
+		))
+	}
+
+	app.Logger().Info(
+		"dubjobs reconciled",
+		"total", len(dubjobs),
+		"queued", total.Queued,
+		"tracked", total.Tracked,
+		"lost", total.Lost,
+		"skipped", total.Skipped,
+		"errors", total.Errors,
+	)
+}
+
+// reconcileRunningDubjob applies the provider's current status. A job
+// that is still running is left to the poller.
+func reconcileRunningDubjob(app core.App, env *base.Env, provider DubbingProvider, dubjob *cmodels.Dubjob) error {
+	// without an expected_ready_in the poller would never pick it up again
+	if dubjob.ExpectedReadyIn.IsZero() {
+		dubjob.ExpectedReadyIn = types.NowDateTime()
+		if err := dubjob.SaveDubjob(app); err != nil {
+			return err.Error
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pollerRequestTimeout)
+	defer cancel()
+
+	res, err := provider.Status(ctx, dubjob.ExternalID)
+	if err != nil {
+		return err.Error
+	}
+	if err := applyProviderStatus(app, env, provider, dubjob, res); err != nil {
+		return err.Error
+	}
+	return nil
+}
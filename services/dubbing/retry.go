@@ -0,0 +1,198 @@
+package dubbing
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const retrierJobID string = "dubjobs_retrier"
+const retryBaseDelay time.Duration = time.Minute
+const retryMaxDelay time.Duration = time.Hour
+
+// retrierLock prevents a slow run from overlapping with the next tick.
+var retrierLock sync.Mutex
+
+// retryDelay is an exponential backoff with jitter: the n-th retry waits
+// somewhere between half and all of base * 2^(n-1), capped at retryMaxDelay.
+func retryDelay(attempt int) time.Duration {
+	delay := retryMaxDelay
+	if attempt < 32 {
+		delay = retryBaseDelay << (attempt - 1)
+	}
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// failDubjob records a failed attempt. The dubjob is scheduled for another
+// attempt with backoff, or dead-lettered once its attempts are exhausted.
+func failDubjob(dao *daos.Dao, dubjob *cmodels.Dubjob, reason string) *utils.CError {
+	dubjob.Attempts++
+	dubjob.ErrorMessage = reason
+
+	if dubjob.Attempts >= dubjob.GetMaxAttempts() {
+		dubjob.NextAttemptIn = types.DateTime{}
+		return deadLetterDubjob(dao, dubjob, reason, fmt.Sprintf("gave up after %d attempts", dubjob.Attempts))
+	}
+
+	nextAttemptIn, err := types.ParseDateTime(time.Now().Add(retryDelay(dubjob.Attempts)))
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	dubjob.NextAttemptIn = nextAttemptIn
+	return dubjob.TransitionWithDao(dao, cmodels.DubjobFailed, reason)
+}
+
+// rejectDubjob dead-letters the dubjob without further attempts, for
+// failures that another attempt would not fix.
+func rejectDubjob(dao *daos.Dao, dubjob *cmodels.Dubjob, reason string) *utils.CError {
+	dubjob.ErrorMessage = reason
+	dubjob.NextAttemptIn = types.DateTime{}
+	return deadLetterDubjob(dao, dubjob, reason, "not retried")
+}
+
+// deadLetterDubjob fails the dubjob and dead-letters it. Nothing retries a
+// dead letter on its own, so the quota it holds is given back with the move.
+func deadLetterDubjob(dao *daos.Dao, dubjob *cmodels.Dubjob, reason string, deadLetterReason string) *utils.CError {
+	var appErr *utils.CError
+	err := dao.RunInTransaction(func(txDao *daos.Dao) error {
+		if appErr = dubjob.TransitionWithDao(txDao, cmodels.DubjobFailed, reason); appErr != nil {
+			return appErr.Error
+		}
+		if appErr = dubjob.TransitionWithDao(txDao, cmodels.DubjobDeadLetter, deadLetterReason); appErr != nil {
+			return appErr.Error
+		}
+		if appErr = refundQuota(txDao, dubjob); appErr != nil {
+			return appErr.Error
+		}
+		return nil
+	})
+	if err != nil {
+		if appErr != nil {
+			return appErr
+		}
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return nil
+}
+
+// retryDubjob puts a failed or dead-lettered dubjob back in the submission
+// queue. The dubbing of the failed attempt is deleted at the provider first,
+// when that fails the dubjob stays as it is and can be retried again.
+// A dead letter gave its quota back, it is reserved again with the move or
+// the dubjob stays dead-lettered with errQuotaExceeded.
+func retryDubjob(app core.App, queue *submissionQueue, dubjob *cmodels.Dubjob, reason string) *utils.CError {
+	if dubjob.ExternalID != "" && dubjob.Provider == queue.provider.Name() {
+		ctx, cancel := context.WithTimeout(context.Background(), pollerRequestTimeout)
+		err := queue.provider.Delete(ctx, dubjob.ExternalID)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+
+	dubjob.ExternalID = ""
+	dubjob.ExpectedReadyIn = types.DateTime{}
+	dubjob.FinishedIn = types.DateTime{}
+	dubjob.NextAttemptIn = types.DateTime{}
+
+	reserve := dubjob.Status == cmodels.DubjobDeadLetter
+	var appErr *utils.CError
+	err := app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
+		if reserve {
+			if appErr = reserveQuota(app, txDao, dubjob); appErr != nil {
+				return appErr.Error
+			}
+		}
+		if appErr = dubjob.TransitionWithDao(txDao, cmodels.DubjobQueued, reason); appErr != nil {
+			return appErr.Error
+		}
+		return nil
+	})
+	if err != nil {
+		if appErr != nil {
+			return appErr
+		}
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	queue.Notify()
+	return nil
+}
+
+// ====================================
+
+func retryDueDubjobs(app core.App, env *base.Env, queue *submissionQueue) {
+	if !retrierLock.TryLock() {
+		return
+	}
+	defer retrierLock.Unlock()
+
+	dubjobs, err := cmodels.FindRetryableDubjobs(app, time.Now())
+	if err != nil {
+		return
+	}
+
+	for _, dubjob := range dubjobs {
+		retryDubjob(app, queue, dubjob, fmt.Sprintf("retry attempt %d of %d", dubjob.Attempts+1, dubjob.GetMaxAttempts()))
+	}
+}
+
+// ====================================
+
+func handleListDeadLetterDubjobs(app core.App, ctx echo.Context, env *base.Env) error {
+	page, errPage := strconv.Atoi(ctx.QueryParamDefault("page", "1"))
+	if errPage != nil || page < 1 {
+		return ctx.JSON(http.StatusBadRequest, utils.CError{Message: "Invalid page"})
+	}
+
+	dubjobs, err := cmodels.FindDubjobs(app, &cmodels.FindDubjobParams{Status: cmodels.DubjobDeadLetter}, dubjobsPerPage, (page-1)*dubjobsPerPage)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+	return ctx.JSON(http.StatusOK, DubjobListResponse{Page: page, PerPage: dubjobsPerPage, Items: dubjobs})
+}
+
+func handleRequeueDubjob(app core.App, ctx echo.Context, env *base.Env, queue *submissionQueue) error {
+	dubjob := &cmodels.Dubjob{}
+	if err := dubjob.FindDubjob(app, &cmodels.FindDubjobParams{Id: ctx.PathParam("dubjob_id")}); err != nil {
+		if err.IsNotFound() {
+			return ctx.JSON(http.StatusNotFound, utils.CError{Message: "Dubjob not found"})
+		}
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+	if dubjob.Status != cmodels.DubjobDeadLetter {
+		return ctx.JSON(http.StatusBadRequest, utils.CError{Message: "Only dead-lettered dubjobs can be requeued"})
+	}
+	if dubjob.IsCleaned() {
+		return ctx.JSON(http.StatusGone, utils.CError{Message: "The dubjob's files were cleaned up after its retention"})
+	}
+
+	// the admin gets a fresh set of attempts
+	dubjob.Attempts = 0
+	if err := retryDubjob(app, queue, dubjob, "requeued by admin"); err != nil {
+		if err.IsConflict() {
+			return ctx.JSON(http.StatusConflict, err)
+		}
+		return ctx.JSON(quotaErrorStatus(err), err)
+	}
+	return ctx.JSON(http.StatusOK, dubjob)
+}
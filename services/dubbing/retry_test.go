@@ -0,0 +1,94 @@
+//go:build !goexperiment.jsonv2
+
+package dubbing
+
+import (
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"context"
+	"errors"
+	"testing"
+)
+
+// deleteRecordingProvider is the fake provider, with Delete recorded and
+// failing on demand.
+type deleteRecordingProvider struct {
+	fakeProvider
+	deleted []string
+	fail    bool
+}
+
+func (p *deleteRecordingProvider) Delete(ctx context.Context, externalID string) *utils.CError {
+	if p.fail {
+		return &utils.CError{Message: "Bad Gateway", Error: errors.New("delete failed")}
+	}
+	p.deleted = append(p.deleted, externalID)
+	return nil
+}
+
+func TestRetryDubjobDeletesTheFailedDubbing(t *testing.T) {
+	app := newTestApp(t)
+	userID := newTestUser(t, app)
+
+	for _, fail := range []bool{false, true} {
+		provider := &deleteRecordingProvider{fail: fail}
+		queue := newSubmissionQueue(app, provider)
+
+		dubjob := newTestDubjob(t, app, userID, 60)
+		dubjob.Provider = provider.Name()
+		dubjob.ExternalID = "fake_1_ok_" + dubjob.Id
+		if err := dubjob.Transition(app, cmodels.DubjobSubmitted, "test"); err != nil {
+			t.Fatal(err)
+		}
+		if err := failDubjob(app.Dao(), dubjob, "test"); err != nil {
+			t.Fatal(err)
+		}
+
+		err := retryDubjob(app, queue, dubjob, "test")
+		if fail {
+			if err == nil || dubjob.Status != cmodels.DubjobFailed || dubjob.ExternalID == "" {
+				t.Fatalf("a failed delete requeued the dubjob: %+v, status %s", err, dubjob.Status)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(provider.deleted) != 1 || provider.deleted[0] != "fake_1_ok_"+dubjob.Id {
+			t.Fatalf("the failed dubbing was not deleted: %v", provider.deleted)
+		}
+		if dubjob.Status != cmodels.DubjobQueued || dubjob.ExternalID != "" {
+			t.Fatalf("status %s, external id %q", dubjob.Status, dubjob.ExternalID)
+		}
+	}
+}
+
+func TestDeadLetterRefundsAndRequeueReservesQuota(t *testing.T) {
+	app := newTestApp(t)
+	userID := newTestUser(t, app)
+	queue := newSubmissionQueue(app, &deleteRecordingProvider{})
+
+	dubjob := newTestDubjob(t, app, userID, 60)
+	if err := reserveQuota(app, app.Dao(), dubjob); err != nil {
+		t.Fatal(err)
+	}
+	if err := rejectDubjob(app.Dao(), dubjob, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if dubjob.Status != cmodels.DubjobDeadLetter {
+		t.Fatalf("status %s", dubjob.Status)
+	}
+	if used := usedSeconds(t, app, userID); used != 0 {
+		t.Fatalf("the dead letter still holds %d seconds", used)
+	}
+
+	if err := retryDubjob(app, queue, dubjob, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if dubjob.Status != cmodels.DubjobQueued {
+		t.Fatalf("status %s", dubjob.Status)
+	}
+	if used := usedSeconds(t, app, userID); used != dubjob.BilledSeconds(60) {
+		t.Fatalf("the requeued dubjob holds %d seconds", used)
+	}
+}
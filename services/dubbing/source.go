@@ -0,0 +1,157 @@
+package dubbing
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/getsentry/sentry-go"
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// SourceMedia is what a provider dubs: either a public URL or a stream of
+// a file uploaded by the user.
+type SourceMedia struct {
+	URL      string
+	FileName string
+	File     io.Reader
+	// size of File (bytes)
+	Size int64
+}
+
+// openSourceMedia returns the dubjob's source. An uploaded file is stored on
+// the dubjob, or once on its dub request for all of the children. The
+// returned close func must be called once the provider is done reading it.
+func openSourceMedia(app core.App, dubjob *cmodels.Dubjob) (*SourceMedia, func(), *utils.CError) {
+	var owner models.Model = dubjob
+	name := dubjob.SourceFile
+	if name == "" && dubjob.DubRequest != "" {
+		dubRequest := &cmodels.DubRequest{}
+		if err := dubRequest.FindDubRequest(app, &cmodels.FindDubRequestParams{Id: dubjob.DubRequest}); err != nil {
+			return nil, nil, err
+		}
+		owner = dubRequest
+		name = dubRequest.SourceFile
+	}
+	if name == "" {
+		return &SourceMedia{URL: dubjob.SourceURL}, func() {}, nil
+	}
+
+	reader, size, err := openModelFile(app, owner, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &SourceMedia{FileName: name, File: reader, Size: size}, func() { reader.Close() }, nil
+}
+
+// dubSource is the source of a new dubjob or dub request.
+type dubSource struct {
+	URL         string
+	File        *filesystem.File
+	Video       *cmodels.Video
+	DurationSec int
+}
+
+// resolveDubSource picks the one source of a create request: a public URL,
+// an uploaded "file" part or an imported video, which brings its own URL
+// and duration. It returns the http status to answer with on failure.
+func resolveDubSource(app core.App, ctx echo.Context, env *base.Env, userID string, sourceURL string, videoID string, durationSec int) (*dubSource, int, *utils.CError) {
+	source := &dubSource{URL: sourceURL, DurationSec: durationSec}
+	if fh, err := ctx.FormFile("file"); err == nil {
+		file, status, appErr := validateSourceUpload(fh)
+		if appErr != nil {
+			return nil, status, appErr
+		}
+		source.File = file
+	}
+	sources := 0
+	for _, given := range []bool{source.File != nil, sourceURL != "", videoID != ""} {
+		if given {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, http.StatusBadRequest, &utils.CError{Message: "Provide either a source_url, a file or a video"}
+	}
+	if videoID != "" {
+		video, status, appErr := findSourceVideo(app, ctx, env, userID, videoID)
+		if appErr != nil {
+			return nil, status, appErr
+		}
+		source.Video = video
+		source.URL = video.ShareURL
+		source.DurationSec = video.DurationSec
+	}
+	// the declared duration is only trusted until the source is measured,
+	// uploads are measured right away and URLs once the provider has them
+	if source.File != nil {
+		if measured, ok := probeSourceDuration(source.File); ok {
+			source.DurationSec = measured
+		}
+	}
+	return source, 0, nil
+}
+
+// ====================================
+
+// validateSourceUpload checks the size and the sniffed MIME type of an
+// uploaded source, so nothing unusable is stored or sent to a provider.
+// It returns the http status to answer with when the upload is rejected.
+func validateSourceUpload(fh *multipart.FileHeader) (*filesystem.File, int, *utils.CError) {
+	if fh.Size <= 0 {
+		return nil, http.StatusBadRequest, &utils.CError{Message: "The uploaded file is empty"}
+	}
+	if fh.Size > int64(cmodels.SourceFileMaxSize) {
+		return nil, http.StatusRequestEntityTooLarge, &utils.CError{Message: fmt.Sprintf("The uploaded file is larger than %d bytes", cmodels.SourceFileMaxSize)}
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, http.StatusInternalServerError, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	defer f.Close()
+
+	mt, err := mimetype.DetectReader(f)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, http.StatusInternalServerError, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	if !mimetype.EqualsAny(mt.String(), cmodels.SourceFileMimeTypes...) {
+		return nil, http.StatusUnsupportedMediaType, &utils.CError{Message: fmt.Sprintf("Unsupported file type: %s", mt.String())}
+	}
+
+	file, err := filesystem.NewFileFromMultipart(fh)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, http.StatusInternalServerError, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return file, http.StatusOK, nil
+}
+
+// probeSourceDuration measures an uploaded source, see probeMediaDuration.
+func probeSourceDuration(file *filesystem.File) (int, bool) {
+	r, err := file.Reader.Open()
+	if err != nil {
+		return 0, false
+	}
+	defer r.Close()
+	return probeMediaDuration(r)
+}
+
+// storeSourceFile uploads the validated source file onto a saved dubjob or
+// dub request and returns its name.
+func storeSourceFile(app core.App, env *base.Env, m models.Model, file *filesystem.File) (string, *utils.CError) {
+	if _, err := uploadModelFile(app, env, m, file); err != nil {
+		return "", err
+	}
+	return file.Name, nil
+}
@@ -0,0 +1,260 @@
+package dubbing
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+const downloadTimeout time.Duration = 30 * time.Minute
+
+type storedFile struct {
+	Name     string
+	URL      string
+	Checksum string
+	Size     int64
+	// 0 when the format can't be probed
+	DurationSec int
+}
+
+type downloadFunc func(w io.Writer) (int64, *utils.CError)
+
+var errFileTooLarge = errors.New("dubjob file is too large")
+
+// storeDubjobFile streams a download into a temp file while hashing it and
+// then uploads it to the dubjob's PocketBase storage directory, so files
+// bigger than memory never have to be buffered. The download is aborted as
+// soon as it grows past maxSize.
+func storeDubjobFile(app core.App, env *base.Env, dubjob *cmodels.Dubjob, originalName string, maxSize int64, download downloadFunc) (*storedFile, *utils.CError) {
+	tmp, err := os.CreateTemp("", "dubjob-*")
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// the download writes into the pipe, closing its reading end makes the
+	// download's next write fail
+	pr, pw := io.Pipe()
+	downloaded := make(chan *utils.CError, 1)
+	go func() {
+		_, appErr := download(pw)
+		if appErr != nil {
+			pw.CloseWithError(appErr.Error)
+		} else {
+			pw.Close()
+		}
+		downloaded <- appErr
+	}()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), io.LimitReader(pr, maxSize+1))
+	if size > maxSize {
+		err = fmt.Errorf("%w: more than %d bytes | dubjob: %s", errFileTooLarge, maxSize, dubjob.Id)
+	}
+	if err != nil {
+		pr.CloseWithError(err)
+	}
+	if appErr := <-downloaded; appErr != nil && !errors.Is(err, errFileTooLarge) {
+		return nil, appErr
+	}
+	if err == nil {
+		err = tmp.Close()
+	}
+	if err == nil && size == 0 {
+		err = fmt.Errorf("dubjob file is empty | dubjob: %s", dubjob.Id)
+	}
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+
+	durationSec := 0
+	if probed, err := os.Open(tmp.Name()); err == nil {
+		durationSec, _ = probeMediaDuration(probed)
+		probed.Close()
+	}
+
+	file, err := filesystem.NewFileFromPath(tmp.Name())
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	file.OriginalName = originalName
+
+	fileURL, appErr := uploadModelFile(app, env, dubjob, file)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	return &storedFile{
+		Name:        file.Name,
+		URL:         fileURL,
+		Checksum:    hex.EncodeToString(hasher.Sum(nil)),
+		Size:        size,
+		DurationSec: durationSec,
+	}, nil
+}
+
+// uploadModelFile stores the file in the storage directory of a dubjob or a
+// dub request and returns its public URL.
+func uploadModelFile(app core.App, env *base.Env, m models.Model, file *filesystem.File) (string, *utils.CError) {
+	collection, err := app.Dao().FindCollectionByNameOrId(m.TableName())
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return "", &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+
+	fs, err := app.NewFilesystem()
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return "", &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	defer fs.Close()
+
+	fileKey := fmt.Sprintf("%s/%s/%s", collection.BaseFilesPath(), m.GetId(), file.Name)
+	if err := fs.UploadFile(file, fileKey); err != nil {
+		eventID := sentry.CaptureException(err)
+		return "", &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+
+	return fmt.Sprintf("%s/api/files/%s/%s/%s", env.DOMAIN, collection.Id, m.GetId(), file.Name), nil
+}
+
+// openModelFile opens a file stored on a dubjob or a dub request for
+// streaming and returns its size. The caller must close the returned reader.
+func openModelFile(app core.App, m models.Model, name string) (io.ReadCloser, int64, *utils.CError) {
+	collection, err := app.Dao().FindCollectionByNameOrId(m.TableName())
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, 0, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+
+	fs, err := app.NewFilesystem()
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, 0, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+
+	reader, err := fs.GetFile(fmt.Sprintf("%s/%s/%s", collection.BaseFilesPath(), m.GetId(), name))
+	if err != nil {
+		fs.Close()
+		eventID := sentry.CaptureException(err)
+		return nil, 0, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return &fsFileReader{ReadCloser: reader, fs: fs}, reader.Size(), nil
+}
+
+// fsFileReader also closes the filesystem the file was opened from.
+type fsFileReader struct {
+	io.ReadCloser
+	fs *filesystem.System
+}
+
+func (r *fsFileReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.fs.Close()
+	return err
+}
+
+// deleteModelFile removes a file previously stored on a dubjob or a dub
+// request.
+func deleteModelFile(app core.App, m models.Model, name string) *utils.CError {
+	if name == "" {
+		return nil
+	}
+
+	collection, err := app.Dao().FindCollectionByNameOrId(m.TableName())
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+
+	fs, err := app.NewFilesystem()
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	defer fs.Close()
+
+	if err := fs.Delete(fmt.Sprintf("%s/%s/%s", collection.BaseFilesPath(), m.GetId(), name)); err != nil {
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return nil
+}
+
+// ====================================
+
+func storeDubbedOutput(app core.App, env *base.Env, provider DubbingProvider, dubjob *cmodels.Dubjob) *utils.CError {
+	ctx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
+	defer cancel()
+
+	originalName := fmt.Sprintf("%s_%s.mp4", dubjob.Id, dubjob.TargetLanguage)
+	stored, err := storeDubjobFile(app, env, dubjob, originalName, int64(cmodels.DubjobMaxFileSize), func(w io.Writer) (int64, *utils.CError) {
+		return provider.Download(ctx, dubjob.ExternalID, dubjob.TargetLanguage, w)
+	})
+	if err != nil {
+		return err
+	}
+
+	previous := dubjob.OutputFile
+	dubjob.OutputFile = stored.Name
+	dubjob.OutputURL = stored.URL
+	dubjob.OutputChecksum = stored.Checksum
+	dubjob.OutputSize = stored.Size
+	dubjob.OutputDurationSec = stored.DurationSec
+	if previous != "" && previous != stored.Name {
+		deleteModelFile(app, dubjob, previous)
+	}
+	return nil
+}
+
+// storeDubbedTranscripts fetches the translated transcript of the dubjob's
+// target language in every subtitle format and stores them on the dubjob.
+// Nothing is replaced unless all formats were fetched.
+func storeDubbedTranscripts(app core.App, env *base.Env, provider DubbingProvider, dubjob *cmodels.Dubjob) *utils.CError {
+	ctx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
+	defer cancel()
+
+	stored := map[TranscriptFormat]*storedFile{}
+	for _, format := range []TranscriptFormat{TranscriptSrt, TranscriptVtt} {
+		originalName := fmt.Sprintf("%s_%s.%s", dubjob.Id, dubjob.TargetLanguage, format)
+		file, err := storeDubjobFile(app, env, dubjob, originalName, int64(cmodels.TranscriptMaxSize), func(w io.Writer) (int64, *utils.CError) {
+			return provider.Transcript(ctx, dubjob.ExternalID, dubjob.TargetLanguage, format, w)
+		})
+		if err != nil {
+			for _, f := range stored {
+				deleteModelFile(app, dubjob, f.Name)
+			}
+			return err
+		}
+		stored[format] = file
+	}
+
+	previousSrt := dubjob.TranscriptSrt
+	previousVtt := dubjob.TranscriptVtt
+	dubjob.TranscriptSrt = stored[TranscriptSrt].Name
+	dubjob.TranscriptVtt = stored[TranscriptVtt].Name
+	if previousSrt != "" && previousSrt != dubjob.TranscriptSrt {
+		deleteModelFile(app, dubjob, previousSrt)
+	}
+	if previousVtt != "" && previousVtt != dubjob.TranscriptVtt {
+		deleteModelFile(app, dubjob, previousVtt)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package dubbing
+
+import (
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestStoreDubjobFileAbortsPastMaxSize(t *testing.T) {
+	dubjob := &cmodels.Dubjob{}
+	var downloadErr error
+	_, err := storeDubjobFile(nil, nil, dubjob, "out.mp4", 1024, func(w io.Writer) (int64, *utils.CError) {
+		// an endless source, only the size limit can stop it
+		chunk := bytes.Repeat([]byte{1}, 256)
+		var written int64
+		for {
+			n, err := w.Write(chunk)
+			written += int64(n)
+			if err != nil {
+				downloadErr = err
+				return written, &utils.CError{Message: "Internal Server Error", Error: err}
+			}
+		}
+	})
+	if err == nil || !errors.Is(err.Error, errFileTooLarge) {
+		t.Fatalf("expected errFileTooLarge, got %+v", err)
+	}
+	if !errors.Is(downloadErr, errFileTooLarge) {
+		t.Errorf("download was not aborted with errFileTooLarge: %v", downloadErr)
+	}
+}
+
+func TestStoreDubjobFileReturnsDownloadError(t *testing.T) {
+	dubjob := &cmodels.Dubjob{}
+	failure := errors.New("provider unavailable")
+	_, err := storeDubjobFile(nil, nil, dubjob, "out.mp4", 1024, func(w io.Writer) (int64, *utils.CError) {
+		w.Write([]byte("partial"))
+		return 7, &utils.CError{Message: "Bad Gateway", Error: failure}
+	})
+	if err == nil || !errors.Is(err.Error, failure) {
+		t.Fatalf("expected the download error, got %+v", err)
+	}
+}
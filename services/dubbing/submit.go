@@ -0,0 +1,84 @@
+package dubbing
+
+import (
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// submitUploadRate is the slowest upload of a source file to the provider
+// that is waited for (bytes per second).
+const submitUploadRate int64 = 1 << 20
+
+// submitTimeout gives the upload of a source file the time it needs on top
+// of the provider request itself.
+func submitTimeout(source *SourceMedia) time.Duration {
+	return pollerRequestTimeout + time.Duration(source.Size/submitUploadRate)*time.Second
+}
+
+// submitDubjob hands a queued dubjob to the provider and moves it to submitted.
+// Pass a transaction dao to roll the local changes back with the caller.
+// When the provider measured the media, the quota held for the dubjob is
+// corrected to it; a source that turns out too long for the remaining quota
+// is cancelled at the provider and fails with errQuotaExceeded.
+func submitDubjob(app core.App, dao *daos.Dao, provider DubbingProvider, dubjob *cmodels.Dubjob) *utils.CError {
+	source, closeSource, err := openSourceMedia(app, dubjob)
+	if err != nil {
+		return err
+	}
+	defer closeSource()
+
+	ctx, cancel := context.WithTimeout(context.Background(), submitTimeout(source))
+	defer cancel()
+
+	submission, err := provider.Submit(ctx, dubjob, source)
+	if err != nil {
+		return err
+	}
+
+	// ===============
+	// convert time to datetime
+	expectedIn, errParse := types.ParseDateTime(time.Now().Add(submission.ExpectedDuration))
+	if errParse != nil {
+		provider.Cancel(ctx, submission.ExternalID)
+		eventID := sentry.CaptureException(errParse)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: errParse}
+	}
+	dubjob.Provider = provider.Name()
+	dubjob.ExternalID = submission.ExternalID
+	dubjob.ExpectedReadyIn = expectedIn
+
+	var appErr *utils.CError
+	errTx := dao.RunInTransaction(func(txDao *daos.Dao) error {
+		if submission.MediaDurationSec > 0 {
+			dubjob.DurationSec = submission.MediaDurationSec
+			if appErr = settleQuota(app, txDao, dubjob, dubjob.BilledSeconds(submission.MediaDurationSec), false); appErr != nil {
+				return appErr.Error
+			}
+		}
+		if appErr = dubjob.TransitionWithDao(txDao, cmodels.DubjobSubmitted, fmt.Sprintf("submitted to %s", provider.Name())); appErr != nil {
+			return appErr.Error
+		}
+		return nil
+	})
+	if errTx == nil {
+		return nil
+	}
+
+	// nothing tracks the provider's dubbing when it was not recorded
+	provider.Cancel(ctx, submission.ExternalID)
+	dubjob.ExternalID = ""
+	dubjob.ExpectedReadyIn = types.DateTime{}
+	if appErr != nil {
+		return appErr
+	}
+	eventID := sentry.CaptureException(errTx)
+	return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: errTx}
+}
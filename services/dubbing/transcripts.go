@@ -0,0 +1,61 @@
+package dubbing
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+var transcriptContentTypes = map[TranscriptFormat]string{
+	TranscriptSrt: "application/x-subrip",
+	TranscriptVtt: "text/vtt",
+}
+
+func handleDownloadTranscript(app core.App, ctx echo.Context, env *base.Env) error {
+	// ==========================
+	// get user
+	user := &cmodels.User{}
+	if err := user.GetUserByContext(ctx); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+
+	format := TranscriptFormat(ctx.QueryParamDefault("format", string(TranscriptSrt)))
+	contentType, ok := transcriptContentTypes[format]
+	if !ok {
+		return ctx.JSON(http.StatusBadRequest, utils.CError{Message: "format must be srt or vtt"})
+	}
+
+	dubjob := &cmodels.Dubjob{}
+	if err := dubjob.FindDubjob(app, &cmodels.FindDubjobParams{Id: ctx.PathParam("dubjob_id"), User: user.Id}); err != nil {
+		if err.IsNotFound() {
+			return ctx.JSON(http.StatusNotFound, utils.CError{Message: "Dubjob not found"})
+		}
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+
+	if dubjob.IsCleaned() {
+		return ctx.JSON(http.StatusGone, utils.CError{Message: "The dubjob's files were cleaned up after its retention"})
+	}
+
+	name := dubjob.TranscriptSrt
+	if format == TranscriptVtt {
+		name = dubjob.TranscriptVtt
+	}
+	if name == "" {
+		return ctx.JSON(http.StatusNotFound, utils.CError{Message: "Transcript not available yet"})
+	}
+
+	reader, _, err := openModelFile(app, dubjob, name)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+	defer reader.Close()
+
+	ctx.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s_%s.%s"`, dubjob.Id, dubjob.TargetLanguage, format))
+	return ctx.Stream(http.StatusOK, contentType, reader)
+}
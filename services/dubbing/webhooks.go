@@ -0,0 +1,98 @@
+package dubbing
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/services/elevenlabs"
+	"basedpocket/utils"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const elevenlabsDubbingEvent string = "dubbing"
+
+func handleElevenlabsWebhook(app core.App, ctx echo.Context, env *base.Env, provider DubbingProvider) error {
+	req := ctx.Request()
+	res := ctx.Response()
+
+	const MaxBodyBytes = int64(65536)
+	req.Body = http.MaxBytesReader(res.Writer, req.Body, MaxBodyBytes)
+	payload, err := io.ReadAll(req.Body)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return ctx.String(http.StatusServiceUnavailable, fmt.Errorf("problem with request. eventID: %s", *eventID).Error())
+	}
+	event, err := elevenlabs.ConstructWebhookEvent(payload, req.Header.Get("ElevenLabs-Signature"), env.ELEVENLABS_WEBHOOK_SECRET)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return ctx.String(http.StatusBadRequest, fmt.Errorf("error verifying webhook signature. eventID: %s", *eventID).Error())
+	}
+
+	// other event types and dubbings we don't know about are acknowledged
+	// so the sender does not keep retrying them
+	if event.Type != elevenlabsDubbingEvent || event.Data.DubbingID == "" || provider.Name() != ElevenlabsProviderName {
+		res.Writer.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	dubjob := &cmodels.Dubjob{}
+	if err := dubjob.FindDubjob(app, &cmodels.FindDubjobParams{ExternalID: event.Data.DubbingID}); err != nil {
+		if err.IsNotFound() {
+			res.Writer.WriteHeader(http.StatusOK)
+			return nil
+		}
+		return ctx.String(http.StatusInternalServerError, err.Error.Error())
+	}
+	if dubjob.Status != cmodels.DubjobSubmitted && dubjob.Status != cmodels.DubjobDubbing {
+		res.Writer.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	// storing a dub downloads its media, which takes longer than the sender
+	// waits for an answer. it runs in the background under the dubjob lock
+	// and the poller picks the dubjob up again when it fails
+	status := webhookProviderStatus(event)
+	if status == nil || status.State == ProviderDubbed {
+		go func() {
+			var appErr *utils.CError
+			if status != nil {
+				appErr = applyProviderStatus(app, env, provider, dubjob, status)
+			} else {
+				appErr = pollDubjob(app, env, provider, dubjob)
+			}
+			if appErr != nil {
+				app.Logger().Error("applying an elevenlabs webhook failed", "dubjob", dubjob.Id, "error", appErr.Error)
+			}
+		}()
+		res.Writer.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	// the other statuses are a transition only, a failure makes the sender
+	// retry the webhook
+	if appErr := applyProviderStatus(app, env, provider, dubjob, status); appErr != nil {
+		return ctx.String(http.StatusInternalServerError, fmt.Errorf("problem applying the dubbing status. eventID: %s", appErr.EventID).Error())
+	}
+
+	res.Writer.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// webhookProviderStatus maps the webhook's status, or returns nil when the
+// provider has to be asked for it.
+func webhookProviderStatus(event *elevenlabs.WebhookEvent) *ProviderStatus {
+	switch event.Data.Status {
+	case elevenlabs.DubbingStatusDubbing:
+		return &ProviderStatus{State: ProviderDubbing}
+	case elevenlabs.DubbingStatusDubbed:
+		return &ProviderStatus{State: ProviderDubbed}
+	case elevenlabs.DubbingStatusFailed:
+		return &ProviderStatus{State: ProviderFailed, Error: event.Data.Error}
+	}
+	return nil
+}
@@ -2,17 +2,16 @@ package elevenlabs
 
 import (
 	"basedpocket/base"
-	"basedpocket/cmodels"
 	"basedpocket/utils"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
-	"net/url"
-	"time"
+	"strconv"
 
 	"github.com/carlmjohnson/requests"
 	"github.com/getsentry/sentry-go"
-	"github.com/labstack/echo/v5"
-	"github.com/pocketbase/pocketbase/core"
-	"github.com/pocketbase/pocketbase/tools/types"
 )
 
 type DubbingResponse struct {
@@ -20,44 +19,193 @@ type DubbingResponse struct {
 	ExpectedDurationSec int    `json:"expected_duration_sec"`
 }
 
-// func GetDubFileURL() {
-// 	"https://api.elevenlabs.io/v1/dubbing/{dubbing_id}/audio/{language_code}"
-// }
+type DubbingStatus string
 
-func RequestAndUpdateDubjob(app core.App, ctx echo.Context, env *base.Env, dubjob *cmodels.Dubjob) *utils.CError {
+const DubbingStatusDubbing DubbingStatus = "dubbing"
+const DubbingStatusDubbed DubbingStatus = "dubbed"
+const DubbingStatusFailed DubbingStatus = "failed"
 
-	formData := url.Values{}
-	formData.Add("mode", "automatic")
-	formData.Add("source_url", dubjob.SourceURL)
-	formData.Add("target_lang", dubjob.TargetLanguage)
+type DubbingMetadataResponse struct {
+	DubbingID       string        `json:"dubbing_id"`
+	Name            string        `json:"name"`
+	Status          DubbingStatus `json:"status"`
+	TargetLanguages []string      `json:"target_languages"`
+	Error           string        `json:"error"`
+}
+
+// CreateDubbingParams takes either a SourceURL or a SourceFile, which is
+// streamed to ElevenLabs as the multipart "file" part.
+type CreateDubbingParams struct {
+	SourceURL           string
+	SourceFile          io.Reader
+	SourceFileName      string
+	SourceLanguage      string
+	TargetLanguage      string
+	NumSpeakers         int
+	Watermark           bool
+	StartTime           int
+	EndTime             int
+	HighestResolution   bool
+	DropBackgroundAudio bool
+}
+
+func CreateDubbing(ctx context.Context, env *base.Env, params *CreateDubbingParams) (*DubbingResponse, *utils.CError) {
+
+	fields := map[string]string{
+		"mode":                  "automatic",
+		"source_lang":           "auto",
+		"target_lang":           params.TargetLanguage,
+		"watermark":             strconv.FormatBool(params.Watermark),
+		"highest_resolution":    strconv.FormatBool(params.HighestResolution),
+		"drop_background_audio": strconv.FormatBool(params.DropBackgroundAudio),
+	}
+	if params.SourceFile == nil {
+		fields["source_url"] = params.SourceURL
+	}
+	if params.SourceLanguage != "" {
+		fields["source_lang"] = params.SourceLanguage
+	}
+	if params.NumSpeakers > 0 {
+		fields["num_speakers"] = strconv.Itoa(params.NumSpeakers)
+	}
+	if params.StartTime > 0 {
+		fields["start_time"] = strconv.Itoa(params.StartTime)
+	}
+	if params.EndTime > 0 {
+		fields["end_time"] = strconv.Itoa(params.EndTime)
+	}
+	boundary := multipart.NewWriter(nil).Boundary()
 
 	// handle response
 	res := &DubbingResponse{}
 	err := requests.
 		URL("https://api.elevenlabs.io/v1/dubbing/").
-		ContentType("multipart/form-data").
+		ContentType("multipart/form-data; boundary="+boundary).
 		Header("xi-api-key", env.ELEVENLABS_API_KEY).
 		Method(http.MethodPost).
-		BodyForm(formData).
+		BodyWriter(func(w io.Writer) error {
+			form := multipart.NewWriter(w)
+			if err := form.SetBoundary(boundary); err != nil {
+				return err
+			}
+			for key, value := range fields {
+				if err := form.WriteField(key, value); err != nil {
+					return err
+				}
+			}
+			if params.SourceFile != nil {
+				part, err := form.CreateFormFile("file", params.SourceFileName)
+				if err != nil {
+					return err
+				}
+				if _, err := io.Copy(part, params.SourceFile); err != nil {
+					return err
+				}
+			}
+			return form.Close()
+		}).
 		ToJSON(&res).
-		Fetch(ctx.Request().Context())
+		Fetch(ctx)
 	if err != nil {
 		eventID := sentry.CaptureException(err)
-		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
 	}
+	return res, nil
+}
+
+// IsRateLimited reports whether ElevenLabs turned a request down with a 429,
+// either for its rate limit or for too many concurrent dubbings.
+func IsRateLimited(err *utils.CError) bool {
+	return err != nil && requests.HasStatusErr(err.Error, http.StatusTooManyRequests)
+}
 
-	// ===============
-	// convert time to datetime
-	expectedIn, err := types.ParseDateTime(time.Now().Add(time.Second * time.Duration(res.ExpectedDurationSec)))
+func IsNotFound(err *utils.CError) bool {
+	return err != nil && requests.HasStatusErr(err.Error, http.StatusNotFound)
+}
+
+func GetDubbing(ctx context.Context, env *base.Env, dubbingID string) (*DubbingMetadataResponse, *utils.CError) {
+	res := &DubbingMetadataResponse{}
+	err := requests.
+		URL("https://api.elevenlabs.io/v1/dubbing/").
+		Pathf("%s", dubbingID).
+		Header("xi-api-key", env.ELEVENLABS_API_KEY).
+		Method(http.MethodGet).
+		ToJSON(&res).
+		Fetch(ctx)
 	if err != nil {
 		eventID := sentry.CaptureException(err)
-		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
 	}
-	dubjob.ExternalID = res.DubbingID
-	dubjob.ExpectedReadyIn = &expectedIn
-	if err := dubjob.SaveDubjob(app); err != nil {
-		return err
+	return res, nil
+}
+
+// DownloadDubbedFile streams the dubbed media of a language into w and
+// returns the number of bytes written. A body shorter than the advertised
+// Content-Length is reported as an error.
+func DownloadDubbedFile(ctx context.Context, env *base.Env, dubbingID string, languageCode string, w io.Writer) (int64, *utils.CError) {
+	var written int64
+	err := requests.
+		URL("https://api.elevenlabs.io/v1/dubbing/").
+		Pathf("%s/audio/%s", dubbingID, languageCode).
+		Header("xi-api-key", env.ELEVENLABS_API_KEY).
+		Method(http.MethodGet).
+		Handle(func(res *http.Response) error {
+			n, err := io.Copy(w, res.Body)
+			written = n
+			if err != nil {
+				return err
+			}
+			if res.ContentLength >= 0 && n != res.ContentLength {
+				return fmt.Errorf("incomplete download: got %d of %d bytes", n, res.ContentLength)
+			}
+			return nil
+		}).
+		Fetch(ctx)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return written, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
 	}
+	return written, nil
+}
 
+type TranscriptFormat string
+
+const TranscriptFormatSrt TranscriptFormat = "srt"
+const TranscriptFormatWebvtt TranscriptFormat = "webvtt"
+
+// DownloadTranscript streams the translated transcript of a language in the
+// given subtitle format into w and returns the number of bytes written.
+func DownloadTranscript(ctx context.Context, env *base.Env, dubbingID string, languageCode string, format TranscriptFormat, w io.Writer) (int64, *utils.CError) {
+	var written int64
+	err := requests.
+		URL("https://api.elevenlabs.io/v1/dubbing/").
+		Pathf("%s/transcript/%s", dubbingID, languageCode).
+		Param("format_type", string(format)).
+		Header("xi-api-key", env.ELEVENLABS_API_KEY).
+		Method(http.MethodGet).
+		Handle(func(res *http.Response) error {
+			n, err := io.Copy(w, res.Body)
+			written = n
+			return err
+		}).
+		Fetch(ctx)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return written, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return written, nil
+}
+
+func DeleteDubbing(ctx context.Context, env *base.Env, dubbingID string) *utils.CError {
+	err := requests.
+		URL("https://api.elevenlabs.io/v1/dubbing/").
+		Pathf("%s", dubbingID).
+		Header("xi-api-key", env.ELEVENLABS_API_KEY).
+		Method(http.MethodDelete).
+		Fetch(ctx)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
 	return nil
 }
@@ -0,0 +1,89 @@
+package elevenlabs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebhookTolerance is how old a signed webhook may be before it is
+// rejected as a possible replay.
+const WebhookTolerance time.Duration = 30 * time.Minute
+
+var ErrInvalidWebhookSignature = errors.New("invalid elevenlabs webhook signature")
+
+type WebhookEvent struct {
+	Type           string             `json:"type"`
+	EventTimestamp int64              `json:"event_timestamp"`
+	Data           WebhookDubbingData `json:"data"`
+}
+
+type WebhookDubbingData struct {
+	DubbingID string        `json:"dubbing_id"`
+	Status    DubbingStatus `json:"status"`
+	Error     string        `json:"error"`
+}
+
+// ConstructWebhookEvent checks the "ElevenLabs-Signature" header, which
+// has the form "t=<unix>,v0=<hex hmac>", against the webhook secret and
+// parses the payload. The HMAC is a SHA-256 of "<unix>.<payload>".
+func ConstructWebhookEvent(payload []byte, header string, secret string) (*WebhookEvent, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("%w: no webhook secret configured", ErrInvalidWebhookSignature)
+	}
+
+	timestamp := ""
+	signatures := []string{}
+	for _, part := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v0":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidWebhookSignature)
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid timestamp", ErrInvalidWebhookSignature)
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > WebhookTolerance || age < -WebhookTolerance {
+		return nil, fmt.Errorf("%w: timestamp outside of tolerance", ErrInvalidWebhookSignature)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	valid := false
+	for _, signature := range signatures {
+		decoded, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(decoded, expected) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, ErrInvalidWebhookSignature
+	}
+
+	event := &WebhookEvent{}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
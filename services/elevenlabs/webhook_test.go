@@ -0,0 +1,60 @@
+package elevenlabs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret string = "whsec_test"
+
+func signWebhook(payload []byte, timestamp time.Time, secret string) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix + "."))
+	mac.Write(payload)
+	return fmt.Sprintf("t=%s,v0=%s", unix, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestConstructWebhookEvent(t *testing.T) {
+	payload := []byte(`{"type":"dubbing","event_timestamp":1,"data":{"dubbing_id":"dub_1","status":"dubbed"}}`)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		payload []byte
+		header  string
+		secret  string
+		valid   bool
+	}{
+		{"valid", payload, signWebhook(payload, now, testWebhookSecret), testWebhookSecret, true},
+		{"tampered payload", []byte(`{"type":"dubbing","data":{"dubbing_id":"dub_2"}}`), signWebhook(payload, now, testWebhookSecret), testWebhookSecret, false},
+		{"wrong secret", payload, signWebhook(payload, now, "whsec_other"), testWebhookSecret, false},
+		{"stale", payload, signWebhook(payload, now.Add(-WebhookTolerance-time.Minute), testWebhookSecret), testWebhookSecret, false},
+		{"from the future", payload, signWebhook(payload, now.Add(WebhookTolerance+time.Minute), testWebhookSecret), testWebhookSecret, false},
+		{"malformed header", payload, "v0=abc", testWebhookSecret, false},
+		{"empty secret", payload, signWebhook(payload, now, ""), "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event, err := ConstructWebhookEvent(test.payload, test.header, test.secret)
+			if !test.valid {
+				if !errors.Is(err, ErrInvalidWebhookSignature) {
+					t.Fatalf("expected an invalid signature, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if event.Data.DubbingID != "dub_1" || event.Data.Status != "dubbed" {
+				t.Fatalf("unexpected event: %+v", event)
+			}
+		})
+	}
+}
@@ -43,7 +43,7 @@ func onCustomerCreatedEvent(app core.App, event stripe.Event) *utils.CError {
 		return err
 	}
 
-	var user *cmodels.User
+	user := &cmodels.User{}
 	if err := user.FindUser(app, &cmodels.FindUserParams{Email: stripeCustomer.Email}); err != nil {
 		return err
 	}
@@ -68,7 +68,7 @@ func onCustomerDeletedEvent(app core.App, event stripe.Event) *utils.CError {
 		return err
 	}
 
-	var customer *cmodels.Customer
+	customer := &cmodels.Customer{}
 	if err := customer.FindCustomer(app, &cmodels.FindCustomerParams{StripeCustomerID: stripeCustomer.ID}); err != nil {
 		return err
 	}
@@ -92,7 +92,7 @@ func onSubscriptionCreatedEvent(app core.App, event stripe.Event) *utils.CError
 		return err
 	}
 
-	var customer *cmodels.Customer
+	customer := &cmodels.Customer{}
 	if err := customer.FindCustomer(app, &cmodels.FindCustomerParams{StripeCustomerID: stripeSubscription.Customer.ID}); err != nil {
 		return err
 	}
@@ -117,7 +117,7 @@ func onSubscriptionUpdatedEvent(app core.App, event stripe.Event) *utils.CError
 		return err
 	}
 
-	var customer *cmodels.Customer
+	customer := &cmodels.Customer{}
 	if err := customer.FindCustomer(app, &cmodels.FindCustomerParams{StripeCustomerID: stripeSubscription.Customer.ID}); err != nil {
 		return err
 	}
@@ -136,7 +136,7 @@ func onSubscriptionDeletedEvent(app core.App, event stripe.Event) *utils.CError
 		return err
 	}
 
-	var customer *cmodels.Customer
+	customer := &cmodels.Customer{}
 	if err := customer.FindCustomer(app, &cmodels.FindCustomerParams{StripeCustomerID: stripeSubscription.Customer.ID}); err != nil {
 		return err
 	}
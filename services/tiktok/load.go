@@ -27,15 +27,15 @@ func LoadTiktok(app *pocketbase.PocketBase, env *base.Env) {
 			},
 		})
 
+		// TikTok redirects the browser here, the user is known from the state
 		e.Router.AddRoute(echo.Route{
-			Method: http.MethodPost,
+			Method: http.MethodGet,
 			Path:   "/platforms/tiktok/oauth-success",
 			Handler: func(c echo.Context) error {
 				return handleOAuthSuccess(e.App, c, env)
 			},
 			Middlewares: []echo.MiddlewareFunc{
 				apis.ActivityLogger(e.App),
-				apis.RequireRecordAuth("users"),
 			},
 		})
 
@@ -51,6 +51,62 @@ func LoadTiktok(app *pocketbase.PocketBase, env *base.Env) {
 			},
 		})
 
+		e.Router.AddRoute(echo.Route{
+			Method: http.MethodPost,
+			Path:   "/platforms/tiktok/:channel_id/publish",
+			Handler: func(c echo.Context) error {
+				return handlePublishVideo(e.App, c, env)
+			},
+			Middlewares: []echo.MiddlewareFunc{
+				apis.ActivityLogger(e.App),
+				apis.RequireRecordAuth("users"),
+			},
+		})
+
+		e.Router.AddRoute(echo.Route{
+			Method: http.MethodGet,
+			Path:   "/platforms/tiktok/:channel_id/publish/:publish_id",
+			Handler: func(c echo.Context) error {
+				return handleFetchPublishStatus(e.App, c, env)
+			},
+			Middlewares: []echo.MiddlewareFunc{
+				apis.ActivityLogger(e.App),
+				apis.RequireRecordAuth("users"),
+			},
+		})
+
+		e.Router.AddRoute(echo.Route{
+			Method: http.MethodPost,
+			Path:   "/platforms/tiktok/:channel_id/videos/import",
+			Handler: func(c echo.Context) error {
+				return handleImportVideos(e.App, c, env)
+			},
+			Middlewares: []echo.MiddlewareFunc{
+				apis.ActivityLogger(e.App),
+				apis.RequireRecordAuth("users"),
+			},
+		})
+
+		e.Router.AddRoute(echo.Route{
+			Method: http.MethodPost,
+			Path:   "/webhooks/tiktok",
+			Handler: func(c echo.Context) error {
+				return handleTiktokWebhook(e.App, c, env)
+			},
+			Middlewares: []echo.MiddlewareFunc{
+				apis.ActivityLogger(e.App),
+			},
+		})
+
+		// ===================
+		// workers
+		refresher := startRefresher(e.App, env)
+
+		app.OnTerminate().Add(func(e *core.TerminateEvent) error {
+			refresher.Stop()
+			return nil
+		})
+
 		return nil
 	})
 }
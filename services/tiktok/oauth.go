@@ -4,23 +4,40 @@ import (
 	"basedpocket/base"
 	"basedpocket/cmodels"
 	"basedpocket/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"sync"
+	"time"
 
 	"github.com/carlmjohnson/requests"
 	"github.com/getsentry/sentry-go"
-	"github.com/labstack/echo/v5"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/daos"
 	"github.com/pocketbase/pocketbase/tools/types"
 )
 
+// oauthStateLifetime is how long a user has to authorize on TikTok.
+const oauthStateLifetime time.Duration = 10 * time.Minute
+
+// pkceChallenge derives the code_challenge of a code_verifier. TikTok
+// expects the SHA-256 hex encoded rather than base64url encoded.
+func pkceChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return hex.EncodeToString(sum[:])
+}
+
 // ====================================
 // ====================================
 // ====================================
 
-func fetchAndStoreAccessToken(app core.App, ctx echo.Context, env *base.Env, code string) *utils.CError {
+// exchangeAuthorizationCode trades the code of the redirect back from TikTok
+// for the channel's tokens.
+func exchangeAuthorizationCode(ctx context.Context, env *base.Env, code string, oauthState *cmodels.OAuthState) (*TikTokAccessTokenResponse, *utils.CError) {
 	// ========================
 	// fetch new access token
 	formData := url.Values{}
@@ -29,6 +46,7 @@ func fetchAndStoreAccessToken(app core.App, ctx echo.Context, env *base.Env, cod
 	formData.Add("code", code)
 	formData.Add("grant_type", "authorization_code")
 	formData.Add("redirect_uri", fmt.Sprintf("%s/platforms/tiktok/oauth-success", env.DOMAIN))
+	formData.Add("code_verifier", oauthState.CodeVerifier)
 	// handle response
 	resRaw := &TikTokAccessTokenResponseRaw{}
 	err := requests.
@@ -36,39 +54,51 @@ func fetchAndStoreAccessToken(app core.App, ctx echo.Context, env *base.Env, cod
 		Method(http.MethodPost).
 		BodyForm(formData).
 		ToJSON(&resRaw).
-		Fetch(ctx.Request().Context())
+		AddValidator(nil).
+		Fetch(ctx)
 	if err != nil {
 		eventID := sentry.CaptureException(err)
-		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
 	}
-	// convert raw response
-	var res *TikTokAccessTokenResponse
-	if err := convertTiktokAccessTokenResponse(resRaw, res); err != nil {
-		return nil
-	}
-	// =================
-	// upsert db
-	appError := upsertTiktokDBOnNewAccess(app, ctx, env, res)
-	if appError != nil {
-		return appError
+	if resRaw.Error != "" {
+		err := fmt.Errorf("error: %s | %s | log_id: %s", resRaw.Error, resRaw.ErrorDescription, resRaw.LogID)
+		eventID := sentry.CaptureException(err)
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
 	}
-
-	return nil
+	// convert raw response
+	return convertTiktokAccessTokenResponse(resRaw)
 }
 
 // ====================================
-func refreshAccessToken(app core.App, ctx echo.Context, env *base.Env, channel *cmodels.Channel) *utils.CError {
-	// ==========================
-	// get user
-	var user *cmodels.User
-	if err := user.GetUserByContext(ctx); err != nil {
-		return err
-	}
 
-	var oauth *cmodels.OAuth
-	if err := oauth.FindOAuth(app, &cmodels.FindOAuthParams{User: user.Id, Channel: oauth.Id}); err != nil {
+var errReauthRequired = errors.New("tiktok channel needs reauthorization")
+
+// channelLocks serializes the token refreshes of a channel, TikTok rotates
+// the refresh token and two refreshes racing would lose one of them.
+var channelLocks sync.Map
+
+func lockChannel(channelID string) func() {
+	value, _ := channelLocks.LoadOrStore(channelID, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// refreshAccessToken exchanges the refresh token of oauth for a new access
+// token and stores it on the oauth and its channel. It needs no request
+// context, so it runs from the refresher as well. When the refresh token is
+// no longer valid the channel is marked as needing reauthorization.
+func refreshAccessToken(app core.App, ctx context.Context, env *base.Env, oauth *cmodels.OAuth) *utils.CError {
+	unlock := lockChannel(oauth.Channel)
+	defer unlock()
+
+	// reload, a refresh that held the lock may have rotated the refresh token
+	if err := oauth.FindOAuth(app, &cmodels.FindOAuthParams{Id: oauth.Id}); err != nil {
 		return err
 	}
+	if oauth.RefreshTokenExpiresIn == nil || oauth.RefreshTokenExpiresIn.Time().Before(time.Now()) {
+		return markNeedsReauth(app, oauth.Channel)
+	}
 
 	formData := url.Values{}
 	formData.Add("client_key", env.TIKTOK_CLIENT_KEY)
@@ -82,104 +112,147 @@ func refreshAccessToken(app core.App, ctx echo.Context, env *base.Env, channel *
 		Method(http.MethodPost).
 		BodyForm(formData).
 		ToJSON(&resRaw).
-		Fetch(ctx.Request().Context())
+		AddValidator(nil).
+		Fetch(ctx)
 	if err != nil {
 		eventID := sentry.CaptureException(err)
-		return &utils.CError{Message: "Internal Server Error", EventID: *eventID}
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	if resRaw.Error == "invalid_grant" {
+		return markNeedsReauth(app, oauth.Channel)
+	}
+	if resRaw.Error != "" {
+		err := fmt.Errorf("error: %s | %s | log_id: %s", resRaw.Error, resRaw.ErrorDescription, resRaw.LogID)
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
 	}
 	// convert raw response
-	var res *TikTokAccessTokenResponse
-	if err := convertTiktokAccessTokenResponse(resRaw, res); err != nil {
-		return nil
+	res, appErr := convertTiktokAccessTokenResponse(resRaw)
+	if appErr != nil {
+		return appErr
 	}
 	// ===============
-	appError := upsertTiktokDBOnNewAccess(app, ctx, env, res)
-	if appError != nil {
-		return appError
+	return storeRefreshedAccess(app, oauth, res)
+}
+
+func storeRefreshedAccess(app core.App, oauth *cmodels.OAuth, response *TikTokAccessTokenResponse) *utils.CError {
+	channel := &cmodels.Channel{}
+	if err := channel.FindChannel(app, &cmodels.FindChannelParams{Id: oauth.Channel}); err != nil {
+		return err
 	}
 
+	err := app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
+		oauth.Scope = response.Scope
+		oauth.AccessToken = response.AccessToken
+		oauth.AccessTokenExpiresIn = response.AccessTokenExpiresIn
+		oauth.RefreshToken = response.RefreshToken
+		oauth.RefreshTokenExpiresIn = response.RefreshTokenExpiresIn
+		if err := txDao.Save(oauth); err != nil {
+			return err
+		}
+		channel.AccessExpiresIn = response.AccessTokenExpiresIn
+		channel.NeedsReauth = false
+		return txDao.Save(channel)
+	})
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
 	return nil
 }
 
+// markNeedsReauth flags the channel so the user is asked to connect it again.
+func markNeedsReauth(app core.App, channelID string) *utils.CError {
+	channel := &cmodels.Channel{}
+	if err := channel.FindChannel(app, &cmodels.FindChannelParams{Id: channelID}); err != nil {
+		return err
+	}
+	channel.NeedsReauth = true
+	if err := channel.SaveChannel(app); err != nil {
+		return err
+	}
+	return &utils.CError{Message: "The channel needs to be reconnected", Error: errReauthRequired}
+}
+
 // ============================================
 
-func upsertTiktokDBOnNewAccess(app core.App, ctx echo.Context, env *base.Env, response *TikTokAccessTokenResponse) *utils.CError {
+// upsertTiktokDBOnNewAccess stores the tokens on the user's channel of the
+// TikTok account, creating the platform and the channel on first connect.
+func upsertTiktokDBOnNewAccess(app core.App, env *base.Env, userID string, response *TikTokAccessTokenResponse) (*cmodels.Channel, *utils.CError) {
 	// ==========================
 	// get user
-	var user *cmodels.User
-	if err := user.GetUserByContext(ctx); err != nil {
-		return err
+	user := &cmodels.User{}
+	if err := user.FindUser(app, &cmodels.FindUserParams{Id: userID}); err != nil {
+		return nil, err
 	}
 
 	// ==========================
 	// find channel
-	var channel *cmodels.Channel
-	if err := channel.Find(app, &cmodels.FindChannelParams{User: user.Id, ExternalID: response.OpenID}); err != nil {
-		return err
+	channel := &cmodels.Channel{}
+	channelErr := channel.FindChannel(app, &cmodels.FindChannelParams{User: user.Id, ExternalID: response.OpenID})
+	if channelErr != nil && !channelErr.IsNotFound() {
+		return nil, channelErr
 	}
-	var oauth *cmodels.OAuth
-	if err := oauth.FindOAuth(app, &cmodels.FindOAuthParams{User: user.Id, Channel: oauth.Id}); err != nil {
-		return err
+	oauth := &cmodels.OAuth{}
+	oauthErr := channelErr
+	if channelErr == nil {
+		// the oauth is gone when the channel was disconnected before
+		oauthErr = oauth.FindOAuth(app, &cmodels.FindOAuthParams{User: user.Id, Channel: channel.Id})
+		if oauthErr != nil && !oauthErr.IsNotFound() {
+			return nil, oauthErr
+		}
+	}
+	// ==========================
+	// find platform
+	platform := &cmodels.Platform{}
+	if err := platform.FindPlatform(app, &cmodels.FindPlatformParams{User: user.Id, Name: cmodels.TikTokPlatform}); err != nil {
+		if !err.IsNotFound() {
+			return nil, err
+		}
+		platform = &cmodels.Platform{User: user.Id, Name: cmodels.TikTokPlatform}
+		if err := platform.SavePlatform(app); err != nil {
+			return nil, err
+		}
 	}
 	// ==========================
 	// start transaction
 	err := app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
-
-		if channel != nil {
-			// ==========================
-			// update channel
-			channel.AccessExpiresIn = response.AccessTokenExpiresIn
-			if appError := channel.Save(app); appError != nil {
-				return fmt.Errorf("points to eventID: %s", appError.EventID)
-			}
-			// ==========================
-			// update oauth
-			oauth.Scope = response.Scope
-			oauth.AccessToken = response.AccessToken
-			oauth.AccessTokenExpiresIn = response.AccessTokenExpiresIn
-			oauth.RefreshToken = response.RefreshToken
-			oauth.RefreshTokenExpiresIn = response.RefreshTokenExpiresIn
-			if appError := oauth.SaveOAuth(app); appError != nil {
-				return fmt.Errorf("points to eventID: %s", appError.EventID)
-			}
-		} else {
+		if channelErr != nil {
 			// ==========================
 			// new channel
-			newChannel := &cmodels.Channel{
-				User:            user.Id,
-				PlatformName:    string(cmodels.TikTokPlatform),
-				ExternalID:      response.OpenID,
-				AccessExpiresIn: response.AccessTokenExpiresIn,
-			}
-			if appError := newChannel.Save(app); appError != nil {
-				return fmt.Errorf("points to eventID: %s", appError.EventID)
+			channel = &cmodels.Channel{
+				User:       user.Id,
+				Platform:   platform.Id,
+				ExternalID: response.OpenID,
 			}
+		}
+		channel.AccessExpiresIn = response.AccessTokenExpiresIn
+		channel.NeedsReauth = false
+		if err := txDao.Save(channel); err != nil {
+			return err
+		}
+
+		if oauthErr != nil {
 			// ==========================
 			// new oauth
-			newOAuth := &cmodels.OAuth{
-				User:                  user.Id,
-				Channel:               newChannel.Id,
-				Scope:                 response.Scope,
-				AccessToken:           response.AccessToken,
-				AccessTokenExpiresIn:  response.AccessTokenExpiresIn,
-				RefreshToken:          response.RefreshToken,
-				RefreshTokenExpiresIn: response.RefreshTokenExpiresIn,
-			}
-			if appError := newOAuth.SaveOAuth(app); appError != nil {
-				return fmt.Errorf("points to eventID: %s", appError.EventID)
+			oauth = &cmodels.OAuth{
+				User:    user.Id,
+				Channel: channel.Id,
 			}
 		}
-
-		return nil
+		oauth.Scope = response.Scope
+		oauth.AccessToken = response.AccessToken
+		oauth.AccessTokenExpiresIn = response.AccessTokenExpiresIn
+		oauth.RefreshToken = response.RefreshToken
+		oauth.RefreshTokenExpiresIn = response.RefreshTokenExpiresIn
+		return txDao.Save(oauth)
 	})
-
 	if err != nil {
-		// insert failed activity
 		eventID := sentry.CaptureException(err)
-		return &utils.CError{Message: "Internal Server Error", EventID: *eventID}
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
 	}
 
-	return nil
+	return channel, nil
 }
 
 // ====================================
@@ -193,6 +266,9 @@ type TikTokAccessTokenResponseRaw struct {
 	RefreshToken          string `json:"refresh_token"`
 	RefreshTokenExpiresIn int64  `json:"refresh_expires_in"`
 	TokenType             string `json:"token_type"`
+	Error                 string `json:"error"`
+	ErrorDescription      string `json:"error_description"`
+	LogID                 string `json:"log_id"`
 }
 
 type TikTokAccessTokenResponse struct {
@@ -205,18 +281,21 @@ type TikTokAccessTokenResponse struct {
 	TokenType             string          `json:"token_type"`
 }
 
-func convertTiktokAccessTokenResponse(raw *TikTokAccessTokenResponseRaw, res *TikTokAccessTokenResponse) *utils.CError {
-	accessTokenExpiresIn, err := types.ParseDateTime(raw.AccessTokenExpiresIn)
+// convertTiktokAccessTokenResponse turns the token lifetimes, which TikTok
+// sends in seconds, into expiry dates.
+func convertTiktokAccessTokenResponse(raw *TikTokAccessTokenResponseRaw) (*TikTokAccessTokenResponse, *utils.CError) {
+	now := time.Now()
+	accessTokenExpiresIn, err := types.ParseDateTime(now.Add(time.Duration(raw.AccessTokenExpiresIn) * time.Second))
 	if err != nil {
 		eventID := sentry.CaptureException(err)
-		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
 	}
-	refreshTokenExpiresIn, err2 := types.ParseDateTime(raw.RefreshTokenExpiresIn)
+	refreshTokenExpiresIn, err2 := types.ParseDateTime(now.Add(time.Duration(raw.RefreshTokenExpiresIn) * time.Second))
 	if err2 != nil {
 		eventID := sentry.CaptureException(err2)
-		return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err2}
+		return nil, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err2}
 	}
-	res = &TikTokAccessTokenResponse{
+	return &TikTokAccessTokenResponse{
 		OpenID:                raw.OpenID,
 		Scope:                 raw.Scope,
 		AccessToken:           raw.AccessToken,
@@ -224,6 +303,5 @@ func convertTiktokAccessTokenResponse(raw *TikTokAccessTokenResponseRaw, res *Ti
 		RefreshToken:          raw.RefreshToken,
 		RefreshTokenExpiresIn: &refreshTokenExpiresIn,
 		TokenType:             raw.TokenType,
-	}
-	return nil
+	}, nil
 }
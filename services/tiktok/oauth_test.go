@@ -0,0 +1,34 @@
+package tiktok
+
+import (
+	"basedpocket/utils"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestPKCEChallenge(t *testing.T) {
+	// TikTok takes the hex encoded SHA-256 of the verifier
+	if challenge := pkceChallenge("abc"); challenge != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Fatalf("unexpected challenge: %s", challenge)
+	}
+
+	verifier, err := utils.GeneratePKCEVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifier) < 43 || len(verifier) > 128 {
+		t.Fatalf("verifier of %d characters", len(verifier))
+	}
+	other, err := utils.GeneratePKCEVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifier == other {
+		t.Fatal("two verifiers are equal")
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	if pkceChallenge(verifier) != hex.EncodeToString(sum[:]) {
+		t.Fatal("the challenge does not match the verifier")
+	}
+}
@@ -0,0 +1,269 @@
+package tiktok
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+var validate = validator.New(validator.WithRequiredStructEnabled())
+
+// PublishVideoBody is sent as JSON, or as the "@jsonPayload" part of a
+// multipart/form-data request whose "file" part is the video to post.
+type PublishVideoBody struct {
+	// post the dubbed output of this dubjob instead of an uploaded file
+	Dubjob string `json:"dubjob"`
+	// or let TikTok pull the video from this URL, its domain has to be
+	// verified in the TikTok developer app
+	VideoURL string   `json:"video_url" validate:"omitempty,url"`
+	PostInfo PostInfo `json:"post_info"`
+}
+
+type PublishVideoResponse struct {
+	PublishID string `json:"publish_id"`
+}
+
+// handlePublishVideo posts an uploaded video, the output of a dubbed dubjob
+// or a video at a URL to one of the user's TikTok channels. Files are
+// uploaded by the server with FILE_UPLOAD, so they work without a verified
+// domain, and the upload runs in the background. A URL is pulled by TikTok
+// with PULL_FROM_URL. The returned publish_id is tracked with
+// handleFetchPublishStatus. A dubjob posted to its own channel is tracked by
+// the dubjobs publisher from then on.
+func handlePublishVideo(app core.App, ctx echo.Context, env *base.Env) error {
+	// ==========================
+	// get user
+	user := &cmodels.User{}
+	if err := user.GetUserByContext(ctx); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+
+	body := &PublishVideoBody{}
+	if err := ctx.Bind(body); err != nil {
+		return ctx.JSON(http.StatusBadRequest, utils.CError{Message: "Invalid request body", Error: err})
+	}
+	if err := validate.Struct(body); err != nil {
+		return ctx.JSON(http.StatusBadRequest, utils.CError{Message: err.Error(), Error: err})
+	}
+	if body.PostInfo.PrivacyLevel == "" {
+		body.PostInfo.PrivacyLevel = PrivacyLevel(cmodels.DefaultPublishPrivacyLevel)
+	}
+
+	oauth, status, appErr := findChannelAccess(app, ctx.Request().Context(), env, user.Id, ctx.PathParam("channel_id"))
+	if appErr != nil {
+		return ctx.JSON(status, appErr)
+	}
+
+	// ==========================
+	// the video is either an uploaded file, a dubjob's output or a URL
+	fh, errFile := ctx.FormFile("file")
+	sources := 0
+	for _, given := range []bool{errFile == nil, body.Dubjob != "", body.VideoURL != ""} {
+		if given {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return ctx.JSON(http.StatusBadRequest, utils.CError{Message: "Provide either a dubjob, a file or a video_url"})
+	}
+	if body.VideoURL != "" {
+		res, appErr := InitVideoPublishFromURL(ctx.Request().Context(), oauth.AccessToken, body.VideoURL, body.PostInfo)
+		if appErr != nil {
+			return ctx.JSON(http.StatusBadGateway, appErr)
+		}
+		return ctx.JSON(http.StatusOK, PublishVideoResponse{PublishID: res.Data.PublishID})
+	}
+
+	var video io.ReadCloser
+	var videoSize int64
+	var dubjob *cmodels.Dubjob
+	if errFile == nil {
+		if fh.Size == 0 || fh.Size > MaxVideoSize {
+			return ctx.JSON(http.StatusBadRequest, utils.CError{Message: "The file is empty or too large"})
+		}
+		// an open file stays readable after the request removes its
+		// multipart temp files, so the background upload can use it
+		file, err := fh.Open()
+		if err != nil {
+			eventID := sentry.CaptureException(err)
+			return ctx.JSON(http.StatusInternalServerError, utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err})
+		}
+		video = file
+		videoSize = fh.Size
+	} else {
+		dubjob = &cmodels.Dubjob{}
+		if err := dubjob.FindDubjob(app, &cmodels.FindDubjobParams{Id: body.Dubjob, User: user.Id}); err != nil {
+			if err.IsNotFound() {
+				return ctx.JSON(http.StatusNotFound, utils.CError{Message: "Dubjob not found"})
+			}
+			return ctx.JSON(http.StatusInternalServerError, err)
+		}
+		if dubjob.Status != cmodels.DubjobDubbed {
+			return ctx.JSON(http.StatusConflict, utils.CError{Message: fmt.Sprintf("A %s dubjob cannot be published", dubjob.Status)})
+		}
+		if dubjob.OutputFile == "" || dubjob.IsCleaned() {
+			return ctx.JSON(http.StatusConflict, utils.CError{Message: "The dubjob has no output to publish"})
+		}
+		// a dub is AI-generated content and has to be labelled as such
+		body.PostInfo.IsAigc = true
+
+		reader, size, err := openDubjobOutput(app, dubjob)
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, err)
+		}
+		video = reader
+		videoSize = size
+	}
+	uploading := false
+	defer func() {
+		if !uploading {
+			video.Close()
+		}
+	}()
+
+	// ==========================
+	// post
+	res, appErr := InitVideoPublishFromFile(ctx.Request().Context(), oauth.AccessToken, videoSize, body.PostInfo)
+	if appErr != nil {
+		return ctx.JSON(http.StatusBadGateway, appErr)
+	}
+
+	// the move to publishing claims the dubjob, a publish that loses the race
+	// is never uploaded
+	tracked := dubjob != nil && dubjob.Channel == oauth.Channel
+	if tracked {
+		dubjob.PublishID = res.Data.PublishID
+		dubjob.PublishError = ""
+		dubjob.PublishAttempts = 0
+		if err := dubjob.Transition(app, cmodels.DubjobPublishing, "published by the user"); err != nil {
+			if err.IsConflict() {
+				return ctx.JSON(http.StatusConflict, utils.CError{Message: "The dubjob changed while it was being published"})
+			}
+			return ctx.JSON(http.StatusInternalServerError, err)
+		}
+	}
+
+	uploading = true
+	StartVideoUpload(res.Data.UploadURL, video, videoSize, func(err *utils.CError) {
+		app.Logger().Error("tiktok video upload failed", "publish_id", res.Data.PublishID, "error", err.Error)
+		if tracked {
+			failDubjobUpload(app, dubjob, err)
+		}
+	})
+
+	return ctx.JSON(http.StatusOK, PublishVideoResponse{PublishID: res.Data.PublishID})
+}
+
+// failDubjobUpload moves a dubjob whose upload failed back to dubbed, unless
+// it has moved on in the meantime.
+func failDubjobUpload(app core.App, dubjob *cmodels.Dubjob, uploadErr *utils.CError) {
+	dubjob.PublishID = ""
+	dubjob.PublishError = uploadErr.Error.Error()
+	if err := dubjob.Transition(app, cmodels.DubjobDubbed, "upload to tiktok failed"); err != nil && !err.IsConflict() {
+		app.Logger().Error("tiktok video upload failure not recorded", "dubjob", dubjob.Id, "error", err.Error)
+	}
+}
+
+func handleFetchPublishStatus(app core.App, ctx echo.Context, env *base.Env) error {
+	// ==========================
+	// get user
+	user := &cmodels.User{}
+	if err := user.GetUserByContext(ctx); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+
+	oauth, status, appErr := findChannelAccess(app, ctx.Request().Context(), env, user.Id, ctx.PathParam("channel_id"))
+	if appErr != nil {
+		return ctx.JSON(status, appErr)
+	}
+
+	res, appErr := FetchPublishStatus(ctx.Request().Context(), oauth.AccessToken, ctx.PathParam("publish_id"))
+	if appErr != nil {
+		return ctx.JSON(http.StatusBadGateway, appErr)
+	}
+
+	return ctx.JSON(http.StatusOK, res.Data)
+}
+
+// ====================================
+
+// findChannelAccess returns the oauth of the user's channel with a usable
+// access token, refreshing it first when it is about to expire. On failure
+// it also returns the HTTP status to answer with.
+func findChannelAccess(app core.App, ctx context.Context, env *base.Env, userID string, channelID string) (*cmodels.OAuth, int, *utils.CError) {
+	channel := &cmodels.Channel{}
+	if err := channel.FindChannel(app, &cmodels.FindChannelParams{Id: channelID, User: userID}); err != nil {
+		if err.IsNotFound() {
+			return nil, http.StatusNotFound, &utils.CError{Message: "Channel not found"}
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	if channel.NeedsReauth {
+		return nil, http.StatusConflict, &utils.CError{Message: "The channel needs to be reconnected"}
+	}
+
+	oauth := &cmodels.OAuth{}
+	if err := oauth.FindOAuth(app, &cmodels.FindOAuthParams{User: userID, Channel: channel.Id}); err != nil {
+		if err.IsNotFound() {
+			return nil, http.StatusConflict, &utils.CError{Message: "The channel is not connected"}
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	if oauth.AccessTokenExpiresIn == nil || oauth.AccessTokenExpiresIn.Time().Before(time.Now().Add(time.Minute)) {
+		if err := refreshAccessToken(app, ctx, env, oauth); err != nil {
+			if errors.Is(err.Error, errReauthRequired) {
+				return nil, http.StatusConflict, err
+			}
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+	return oauth, 0, nil
+}
+
+// openDubjobOutput opens the dubbed video of the dubjob and returns its size.
+// The caller must close the returned reader.
+func openDubjobOutput(app core.App, dubjob *cmodels.Dubjob) (io.ReadCloser, int64, *utils.CError) {
+	collection, err := app.Dao().FindCollectionByNameOrId(dubjob.TableName())
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, 0, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+
+	fs, err := app.NewFilesystem()
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return nil, 0, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+
+	reader, err := fs.GetFile(fmt.Sprintf("%s/%s/%s", collection.BaseFilesPath(), dubjob.Id, dubjob.OutputFile))
+	if err != nil {
+		fs.Close()
+		eventID := sentry.CaptureException(err)
+		return nil, 0, &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+	}
+	return &fsFileReader{ReadCloser: reader, fs: fs}, reader.Size(), nil
+}
+
+// fsFileReader also closes the filesystem the file was opened from.
+type fsFileReader struct {
+	io.ReadCloser
+	fs *filesystem.System
+}
+
+func (r *fsFileReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.fs.Close()
+	return err
+}
@@ -0,0 +1,229 @@
+package tiktok
+
+import (
+	"basedpocket/utils"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/getsentry/sentry-go"
+)
+
+type PrivacyLevel string
+
+const PublicToEveryone PrivacyLevel = "PUBLIC_TO_EVERYONE"
+const MutualFollowFriends PrivacyLevel = "MUTUAL_FOLLOW_FRIENDS"
+const FollowerOfCreator PrivacyLevel = "FOLLOWER_OF_CREATOR"
+const SelfOnly PrivacyLevel = "SELF_ONLY"
+
+type PublishStatus string
+
+const PublishProcessingDownload PublishStatus = "PROCESSING_DOWNLOAD"
+const PublishProcessingUpload PublishStatus = "PROCESSING_UPLOAD"
+const PublishSendToUserInbox PublishStatus = "SEND_TO_USER_INBOX"
+const PublishComplete PublishStatus = "PUBLISH_COMPLETE"
+const PublishFailed PublishStatus = "FAILED"
+
+// PostInfo is the "post_info" of a video publish.
+type PostInfo struct {
+	Title              string       `json:"title,omitempty" validate:"max=2200"`
+	PrivacyLevel       PrivacyLevel `json:"privacy_level" validate:"omitempty,oneof=PUBLIC_TO_EVERYONE MUTUAL_FOLLOW_FRIENDS FOLLOWER_OF_CREATOR SELF_ONLY"`
+	DisableDuet        bool         `json:"disable_duet"`
+	DisableComment     bool         `json:"disable_comment"`
+	DisableStitch      bool         `json:"disable_stitch"`
+	BrandContentToggle bool         `json:"brand_content_toggle"`
+	BrandOrganicToggle bool         `json:"brand_organic_toggle"`
+	IsAigc             bool         `json:"is_aigc"`
+}
+
+// A file is uploaded in chunks of uploadChunkSize, the last chunk takes the
+// remainder. TikTok accepts 5 to 64 MB per chunk and uploads whole files
+// smaller than a chunk.
+const uploadChunkSize int64 = 10 * 1024 * 1024
+
+// MaxVideoSize is the largest video TikTok accepts.
+const MaxVideoSize int64 = 4 * 1024 * 1024 * 1024
+
+// videoUploadTimeout bounds a background upload, it leaves room for a video
+// of MaxVideoSize on a slow uplink.
+const videoUploadTimeout time.Duration = 2 * time.Hour
+
+type sourceInfo struct {
+	Source          string `json:"source"`
+	VideoURL        string `json:"video_url,omitempty"`
+	VideoSize       int64  `json:"video_size,omitempty"`
+	ChunkSize       int64  `json:"chunk_size,omitempty"`
+	TotalChunkCount int64  `json:"total_chunk_count,omitempty"`
+}
+
+type videoInitRequest struct {
+	PostInfo   PostInfo   `json:"post_info"`
+	SourceInfo sourceInfo `json:"source_info"`
+}
+
+// APIError is the "error" object of every content posting response.
+// A code of "ok" means the call succeeded.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	LogID   string `json:"log_id"`
+}
+
+type VideoInitResponse struct {
+	Data struct {
+		PublishID string `json:"publish_id"`
+		UploadURL string `json:"upload_url"`
+	} `json:"data"`
+	Error APIError `json:"error"`
+}
+
+type PublishStatusResponse struct {
+	Data struct {
+		Status                   PublishStatus `json:"status"`
+		FailReason               string        `json:"fail_reason"`
+		PubliclyAvailablePostIDs []int64       `json:"publicaly_available_post_id"`
+		UploadedBytes            int64         `json:"uploaded_bytes"`
+	} `json:"data"`
+	Error APIError `json:"error"`
+}
+
+// ====================================
+
+// InitVideoPublishFromURL starts a direct post of a video TikTok pulls from
+// videoURL. The URL's domain has to be verified in the TikTok developer app.
+func InitVideoPublishFromURL(ctx context.Context, accessToken string, videoURL string, postInfo PostInfo) (*VideoInitResponse, *utils.CError) {
+	res := &VideoInitResponse{}
+	err := requests.
+		URL("https://open.tiktokapis.com/v2/post/publish/video/init/").
+		Method(http.MethodPost).
+		Bearer(accessToken).
+		BodyJSON(&videoInitRequest{
+			PostInfo:   postInfo,
+			SourceInfo: sourceInfo{Source: "PULL_FROM_URL", VideoURL: videoURL},
+		}).
+		ToJSON(res).
+		AddValidator(nil).
+		Fetch(ctx)
+	if appErr := checkAPIError(err, res.Error); appErr != nil {
+		return nil, appErr
+	}
+	return res, nil
+}
+
+// InitVideoPublishFromFile starts a direct post of a video of videoSize
+// bytes that is uploaded afterwards, to the returned upload_url, with
+// UploadVideo.
+func InitVideoPublishFromFile(ctx context.Context, accessToken string, videoSize int64, postInfo PostInfo) (*VideoInitResponse, *utils.CError) {
+	chunkSize, chunkCount := uploadChunks(videoSize)
+	res := &VideoInitResponse{}
+	err := requests.
+		URL("https://open.tiktokapis.com/v2/post/publish/video/init/").
+		Method(http.MethodPost).
+		Bearer(accessToken).
+		BodyJSON(&videoInitRequest{
+			PostInfo: postInfo,
+			SourceInfo: sourceInfo{
+				Source:          "FILE_UPLOAD",
+				VideoSize:       videoSize,
+				ChunkSize:       chunkSize,
+				TotalChunkCount: chunkCount,
+			},
+		}).
+		ToJSON(res).
+		AddValidator(nil).
+		Fetch(ctx)
+	if appErr := checkAPIError(err, res.Error); appErr != nil {
+		return nil, appErr
+	}
+	return res, nil
+}
+
+// UploadVideo streams the video to the upload_url of a FILE_UPLOAD publish,
+// one PUT per chunk, in the chunking announced by InitVideoPublishFromFile.
+func UploadVideo(ctx context.Context, uploadURL string, video io.Reader, videoSize int64) *utils.CError {
+	chunkSize, chunkCount := uploadChunks(videoSize)
+	for i := int64(0); i < chunkCount; i++ {
+		start := i * chunkSize
+		length := chunkSize
+		if i == chunkCount-1 {
+			length = videoSize - start
+		}
+
+		builder := requests.
+			URL(uploadURL).
+			Method(http.MethodPut).
+			ContentType("video/mp4").
+			Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, videoSize)).
+			BodyReader(io.LimitReader(video, length)).
+			CheckStatus(http.StatusPartialContent, http.StatusCreated)
+		req, err := builder.Request(ctx)
+		if err != nil {
+			eventID := sentry.CaptureException(err)
+			return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+		}
+		// TikTok rejects chunked transfer encoding
+		req.ContentLength = length
+		if err := builder.Do(req); err != nil {
+			err = fmt.Errorf("tiktok upload of chunk %d/%d failed: %w", i+1, chunkCount, err)
+			eventID := sentry.CaptureException(err)
+			return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+		}
+	}
+	return nil
+}
+
+// StartVideoUpload uploads the video of a FILE_UPLOAD publish in the
+// background and closes it once done, a video of MaxVideoSize takes longer
+// than a request can wait. onFailure, when set, gets the error of a failed
+// upload.
+func StartVideoUpload(uploadURL string, video io.ReadCloser, videoSize int64, onFailure func(*utils.CError)) {
+	go func() {
+		defer video.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), videoUploadTimeout)
+		defer cancel()
+		if err := UploadVideo(ctx, uploadURL, video, videoSize); err != nil && onFailure != nil {
+			onFailure(err)
+		}
+	}()
+}
+
+func FetchPublishStatus(ctx context.Context, accessToken string, publishID string) (*PublishStatusResponse, *utils.CError) {
+	res := &PublishStatusResponse{}
+	err := requests.
+		URL("https://open.tiktokapis.com/v2/post/publish/status/fetch/").
+		Method(http.MethodPost).
+		Bearer(accessToken).
+		BodyJSON(map[string]string{"publish_id": publishID}).
+		ToJSON(res).
+		AddValidator(nil).
+		Fetch(ctx)
+	if appErr := checkAPIError(err, res.Error); appErr != nil {
+		return nil, appErr
+	}
+	return res, nil
+}
+
+// uploadChunks returns the chunk size and count TikTok expects for a video
+// of videoSize bytes.
+func uploadChunks(videoSize int64) (int64, int64) {
+	if videoSize <= uploadChunkSize {
+		return videoSize, 1
+	}
+	return uploadChunkSize, videoSize / uploadChunkSize
+}
+
+// checkAPIError turns a failed call into a CError. TikTok explains most
+// failures in the body's error object, so non-2xx bodies are decoded too.
+func checkAPIError(err error, apiErr APIError) *utils.CError {
+	if err == nil && (apiErr.Code == "" || apiErr.Code == "ok") {
+		return nil
+	}
+	if err == nil || apiErr.Code != "" {
+		err = fmt.Errorf("tiktok api error: %s | %s | log_id: %s", apiErr.Code, apiErr.Message, apiErr.LogID)
+	}
+	eventID := sentry.CaptureException(err)
+	return &utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err}
+}
@@ -0,0 +1,93 @@
+package tiktok
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/cron"
+)
+
+const refresherJobID string = "tiktok_token_refresher"
+const refresherSchedule string = "*/10 * * * *"
+const oauthStatesCleanupJobID string = "tiktok_oauth_states_cleanup"
+const oauthStatesCleanupSchedule string = "0 * * * *"
+const refresherRequestTimeout time.Duration = 30 * time.Second
+
+// refreshAhead is how long before its expiry an access token is refreshed.
+// TikTok access tokens live for 24 hours.
+const refreshAhead time.Duration = time.Hour
+
+// refresherLock prevents a slow run from overlapping with the next tick.
+var refresherLock sync.Mutex
+
+func startRefresher(app core.App, env *base.Env) *cron.Cron {
+	scheduler := cron.New()
+	scheduler.MustAdd(refresherJobID, refresherSchedule, func() {
+		refreshExpiringTokens(app, env)
+	})
+	scheduler.MustAdd(profileSyncJobID, profileSyncSchedule, func() {
+		syncChannelProfiles(app, env)
+	})
+	scheduler.MustAdd(oauthStatesCleanupJobID, oauthStatesCleanupSchedule, func() {
+		if err := cmodels.DeleteExpiredOAuthStates(app, time.Now()); err != nil {
+			app.Logger().Error("tiktok oauth states cleanup failed", "error", err.Error)
+		}
+	})
+	scheduler.Start()
+	return scheduler
+}
+
+// refreshExpiringTokens refreshes every access token that expires within
+// refreshAhead, skipping channels already waiting for reauthorization.
+func refreshExpiringTokens(app core.App, env *base.Env) {
+	if !refresherLock.TryLock() {
+		return
+	}
+	defer refresherLock.Unlock()
+
+	oauths, err := cmodels.FindExpiringOAuths(app, time.Now().Add(refreshAhead))
+	if err != nil {
+		app.Logger().Error("tiktok token refresh failed", "error", err.Error)
+		return
+	}
+
+	refreshed := 0
+	reauth := 0
+	failed := 0
+	for _, oauth := range oauths {
+		channel := &cmodels.Channel{}
+		if err := channel.FindChannel(app, &cmodels.FindChannelParams{Id: oauth.Channel}); err != nil {
+			failed++
+			continue
+		}
+		if channel.NeedsReauth {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), refresherRequestTimeout)
+		err := refreshAccessToken(app, ctx, env, oauth)
+		cancel()
+		switch {
+		case err == nil:
+			refreshed++
+		case errors.Is(err.Error, errReauthRequired):
+			reauth++
+		default:
+			failed++
+		}
+	}
+
+	if refreshed+reauth+failed > 0 {
+		app.Logger().Info(
+			"tiktok tokens refreshed",
+			"refreshed", refreshed,
+			"needs_reauth", reauth,
+			"errors", failed,
+		)
+	}
+}
@@ -7,32 +7,66 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/carlmjohnson/requests"
 	"github.com/getsentry/sentry-go"
 	"github.com/labstack/echo/v5"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
 )
 
+type OAuthRequestResponse struct {
+	URL string `json:"url"`
+}
+
+// handleOAuthRequest answers with the TikTok authorize url for the frontend
+// to navigate to, a redirect can't be followed by the authenticated fetch
+// that calls it.
 func handleOAuthRequest(app core.App, ctx echo.Context, env *base.Env) error {
+	// ==========================
+	// get user
+	user := &cmodels.User{}
+	if err := user.GetUserByContext(ctx); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
 
-	csrfState, err := utils.GenerateCSRFState()
+	// ==========================
+	// bind the state and the PKCE verifier to the user
+	state, err := utils.GenerateCSRFState()
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return ctx.JSON(http.StatusInternalServerError, utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err})
+	}
+	codeVerifier, err := utils.GeneratePKCEVerifier()
 	if err != nil {
 		eventID := sentry.CaptureException(err)
 		return ctx.JSON(http.StatusInternalServerError, utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err})
 	}
-	ctx.SetCookie(&http.Cookie{
-		Name:   "csrfState",
-		Value:  csrfState,
-		MaxAge: 60,
-	})
+	expiresIn, err := types.ParseDateTime(time.Now().Add(oauthStateLifetime))
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return ctx.JSON(http.StatusInternalServerError, utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err})
+	}
+	oauthState := &cmodels.OAuthState{
+		User:         user.Id,
+		Platform:     cmodels.TikTokPlatform,
+		State:        state,
+		CodeVerifier: codeVerifier,
+		ExpiresIn:    expiresIn,
+	}
+	if err := oauthState.SaveOAuthState(app); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
 
 	queries := map[string]string{
-		"client_key":    env.TIKTOK_CLIENT_KEY,
-		"scope":         "user.info.basic,user.info.profile,user.info.stats,video.list,video.publish,video.upload",
-		"response_type": "code",
-		"redirect_uri":  fmt.Sprintf("%s/platforms/tiktok/oauth-success", env.DOMAIN),
-		"state":         csrfState,
+		"client_key":            env.TIKTOK_CLIENT_KEY,
+		"scope":                 "user.info.basic,user.info.profile,user.info.stats,video.list,video.publish,video.upload",
+		"response_type":         "code",
+		"redirect_uri":          fmt.Sprintf("%s/platforms/tiktok/oauth-success", env.DOMAIN),
+		"state":                 state,
+		"code_challenge":        pkceChallenge(codeVerifier),
+		"code_challenge_method": "S256",
 	}
 
 	url, err := utils.BuildURLFromMap("https://www.tiktok.com/v2/auth/authorize?", queries)
@@ -41,29 +75,78 @@ func handleOAuthRequest(app core.App, ctx echo.Context, env *base.Env) error {
 		return ctx.JSON(http.StatusInternalServerError, utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err})
 	}
 
-	return ctx.Redirect(http.StatusTemporaryRedirect, url)
+	return ctx.JSON(http.StatusOK, OAuthRequestResponse{URL: url})
 }
 
 // ====================================
 
+// Reason codes of the connect failure page.
+const connectInvalidRequest string = "invalid_request"
+const connectInvalidState string = "invalid_state"
+const connectAccessDenied string = "access_denied"
+const connectAuthorizationFailed string = "authorization_failed"
+const connectTokenExchangeFailed string = "token_exchange_failed"
+const connectStorageFailed string = "storage_failed"
+
+// handleOAuthSuccess completes the connect before redirecting the browser
+// to the frontend's success page, or to its failure page with a reason
+// code. Both outcomes are recorded as an event of the user, unless the
+// state is invalid and the user is unknown.
 func handleOAuthSuccess(app core.App, ctx echo.Context, env *base.Env) error {
 
 	// handle response
 	resp := new(TikTokAuthorizationResponseRaw)
 	if err := ctx.Bind(resp); err != nil {
-		eventID := sentry.CaptureException(err)
-		return ctx.JSON(http.StatusInternalServerError, utils.CError{Message: "Internal Server Error", EventID: *eventID})
+		sentry.CaptureException(err)
+		return redirectConnectFailed(ctx, env, connectInvalidRequest)
 	}
+
+	// the redirect carries no auth, the state tells who started the flow
+	oauthState := &cmodels.OAuthState{}
+	if err := oauthState.ConsumeOAuthState(app, cmodels.TikTokPlatform, resp.State); err != nil {
+		app.Logger().Warn("tiktok connect with an invalid state", "error", err.Error)
+		return redirectConnectFailed(ctx, env, connectInvalidState)
+	}
+
 	if resp.Error != "" {
-		err := fmt.Errorf("error: %s | %s", resp.Error, resp.ErrorDescription)
-		eventID := sentry.CaptureException(err)
-		return ctx.JSON(http.StatusInternalServerError, utils.CError{Message: err.Error(), EventID: *eventID, Error: err})
+		reason := connectAuthorizationFailed
+		if resp.Error == "access_denied" {
+			reason = connectAccessDenied
+		} else {
+			sentry.CaptureException(fmt.Errorf("error: %s | %s", resp.Error, resp.ErrorDescription))
+		}
+		return failConnect(app, ctx, env, oauthState.User, reason)
 	}
 
-	// fetch and store access token
-	go fetchAndStoreAccessToken(app, ctx, env, resp.Code)
+	// ==========================
+	// exchange the code and store the tokens
+	res, err := exchangeAuthorizationCode(ctx.Request().Context(), env, resp.Code, oauthState)
+	if err != nil {
+		return failConnect(app, ctx, env, oauthState.User, connectTokenExchangeFailed)
+	}
+	channel, err := upsertTiktokDBOnNewAccess(app, env, oauthState.User, res)
+	if err != nil {
+		return failConnect(app, ctx, env, oauthState.User, connectStorageFailed)
+	}
+
+	// the profile is synced again on schedule, a failure here is not fatal
+	if err := syncChannelProfile(app, ctx.Request().Context(), env, channel); err != nil {
+		app.Logger().Warn("tiktok profile sync on connect failed", "channel", channel.Id, "error", err.Error)
+	}
+
+	cmodels.RecordEvent(app, oauthState.User, channel.Id, cmodels.SuccessStatus, "TikTok channel connected")
+	query := url.Values{"channel": {channel.Id}}
+	return ctx.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%s/platforms/tiktok/connected?%s", env.FRONTEND_DOMAIN, query.Encode()))
+}
+
+func failConnect(app core.App, ctx echo.Context, env *base.Env, userID string, reason string) error {
+	cmodels.RecordEvent(app, userID, "", cmodels.ErrorStatus, fmt.Sprintf("TikTok connect failed: %s", reason))
+	return redirectConnectFailed(ctx, env, reason)
+}
 
-	return ctx.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%s/user", env.FRONTEND_DOMAIN))
+func redirectConnectFailed(ctx echo.Context, env *base.Env, reason string) error {
+	query := url.Values{"reason": {reason}}
+	return ctx.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("%s/platforms/tiktok/connect-failed?%s", env.FRONTEND_DOMAIN, query.Encode()))
 }
 
 // ====================================
@@ -71,7 +154,7 @@ func handleRevokeToken(app core.App, ctx echo.Context, env *base.Env) error {
 
 	// ==========================
 	// get user
-	var user *cmodels.User
+	user := &cmodels.User{}
 	if err := user.GetUserByContext(ctx); err != nil {
 		return ctx.JSON(http.StatusInternalServerError, err)
 	}
@@ -82,7 +165,7 @@ func handleRevokeToken(app core.App, ctx echo.Context, env *base.Env) error {
 		eventID := sentry.CaptureException(err)
 		return ctx.JSON(http.StatusInternalServerError, utils.CError{Message: "Internal Server Error", EventID: *eventID, Error: err})
 	}
-	var oauth *cmodels.OAuth
+	oauth := &cmodels.OAuth{}
 	if err := oauth.FindOAuth(app, &cmodels.FindOAuthParams{User: user.Id, Channel: channelID}); err != nil {
 		return ctx.JSON(http.StatusInternalServerError, err)
 	}
@@ -112,10 +195,11 @@ func handleRevokeToken(app core.App, ctx echo.Context, env *base.Env) error {
 // ====================================
 // ====================================
 
+// TikTokAuthorizationResponseRaw is the query of the redirect back from TikTok.
 type TikTokAuthorizationResponseRaw struct {
-	Code             string `json:"code"`
-	Scopes           string `json:"scopes"`
-	State            string `json:"state"`
-	Error            string `json:"error"`
-	ErrorDescription string `json:"error_description"`
+	Code             string `query:"code" json:"code"`
+	Scopes           string `query:"scopes" json:"scopes"`
+	State            string `query:"state" json:"state"`
+	Error            string `query:"error" json:"error"`
+	ErrorDescription string `query:"error_description" json:"error_description"`
 }
@@ -0,0 +1,153 @@
+package tiktok
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const profileSyncJobID string = "tiktok_profile_sync"
+const profileSyncSchedule string = "15 */6 * * *"
+
+// profileSyncLock prevents a slow run from overlapping with the next one.
+var profileSyncLock sync.Mutex
+
+// userInfoFields are the fields granted by the user.info.basic,
+// user.info.profile and user.info.stats scopes.
+var userInfoFields = []string{
+	"open_id",
+	"avatar_url",
+	"display_name",
+	"username",
+	"bio_description",
+	"profile_deep_link",
+	"is_verified",
+	"follower_count",
+	"following_count",
+	"likes_count",
+	"video_count",
+}
+
+type UserInfo struct {
+	OpenID          string `json:"open_id"`
+	AvatarURL       string `json:"avatar_url"`
+	DisplayName     string `json:"display_name"`
+	Username        string `json:"username"`
+	BioDescription  string `json:"bio_description"`
+	ProfileDeepLink string `json:"profile_deep_link"`
+	IsVerified      bool   `json:"is_verified"`
+	FollowerCount   int64  `json:"follower_count"`
+	FollowingCount  int64  `json:"following_count"`
+	LikesCount      int64  `json:"likes_count"`
+	VideoCount      int64  `json:"video_count"`
+}
+
+type UserInfoResponse struct {
+	Data struct {
+		User UserInfo `json:"user"`
+	} `json:"data"`
+	Error APIError `json:"error"`
+}
+
+// ====================================
+
+func FetchUserInfo(ctx context.Context, accessToken string) (*UserInfoResponse, *utils.CError) {
+	res := &UserInfoResponse{}
+	err := requests.
+		URL("https://open.tiktokapis.com/v2/user/info/").
+		Param("fields", strings.Join(userInfoFields, ",")).
+		Method(http.MethodGet).
+		Bearer(accessToken).
+		ToJSON(res).
+		AddValidator(nil).
+		Fetch(ctx)
+	if appErr := checkAPIError(err, res.Error); appErr != nil {
+		return nil, appErr
+	}
+	return res, nil
+}
+
+// ====================================
+
+// syncChannelProfile copies the TikTok profile and stats of the channel's
+// account onto the channel.
+func syncChannelProfile(app core.App, ctx context.Context, env *base.Env, channel *cmodels.Channel) *utils.CError {
+	oauth, _, err := findChannelAccess(app, ctx, env, channel.User, channel.Id)
+	if err != nil {
+		return err
+	}
+
+	res, err := FetchUserInfo(ctx, oauth.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	// reload, the access lookup may have refreshed the channel's token
+	if err := channel.FindChannel(app, &cmodels.FindChannelParams{Id: channel.Id}); err != nil {
+		return err
+	}
+	info := res.Data.User
+	channel.ChannelProfile = cmodels.ChannelProfile{
+		DisplayName:     info.DisplayName,
+		Username:        info.Username,
+		AvatarURL:       info.AvatarURL,
+		BioDescription:  info.BioDescription,
+		ProfileURL:      info.ProfileDeepLink,
+		IsVerified:      info.IsVerified,
+		FollowerCount:   info.FollowerCount,
+		FollowingCount:  info.FollowingCount,
+		LikesCount:      info.LikesCount,
+		VideoCount:      info.VideoCount,
+		ProfileSyncedIn: types.NowDateTime(),
+	}
+	return channel.SaveChannel(app)
+}
+
+// syncChannelProfiles refreshes the profile of every connected TikTok
+// channel, so the dashboard stays current without the user reconnecting.
+func syncChannelProfiles(app core.App, env *base.Env) {
+	if !profileSyncLock.TryLock() {
+		return
+	}
+	defer profileSyncLock.Unlock()
+
+	channels, err := cmodels.FindConnectedChannels(app, cmodels.TikTokPlatform)
+	if err != nil {
+		app.Logger().Error("tiktok profile sync failed", "error", err.Error)
+		return
+	}
+
+	synced := 0
+	reauth := 0
+	failed := 0
+	for _, channel := range channels {
+		ctx, cancel := context.WithTimeout(context.Background(), refresherRequestTimeout)
+		err := syncChannelProfile(app, ctx, env, channel)
+		cancel()
+		switch {
+		case err == nil:
+			synced++
+		case errors.Is(err.Error, errReauthRequired):
+			reauth++
+		default:
+			failed++
+		}
+	}
+
+	app.Logger().Info(
+		"tiktok profiles synced",
+		"channels", len(channels),
+		"synced", synced,
+		"needs_reauth", reauth,
+		"errors", failed,
+	)
+}
@@ -0,0 +1,210 @@
+package tiktok
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// videoPageSize is the most videos TikTok returns per list or query call.
+const videoPageSize int = 20
+
+// maxImportPages bounds a single import request, the response's cursor
+// continues where it stopped.
+const maxImportPages int = 25
+
+var videoFields = []string{
+	"id",
+	"create_time",
+	"cover_image_url",
+	"share_url",
+	"video_description",
+	"duration",
+	"title",
+	"embed_link",
+	"view_count",
+}
+
+type VideoObject struct {
+	ID               string `json:"id"`
+	CreateTime       int64  `json:"create_time"`
+	CoverImageURL    string `json:"cover_image_url"`
+	ShareURL         string `json:"share_url"`
+	VideoDescription string `json:"video_description"`
+	Duration         int    `json:"duration"`
+	Title            string `json:"title"`
+	EmbedLink        string `json:"embed_link"`
+	ViewCount        int64  `json:"view_count"`
+}
+
+type VideoListResponse struct {
+	Data struct {
+		Videos  []VideoObject `json:"videos"`
+		Cursor  int64         `json:"cursor"`
+		HasMore bool          `json:"has_more"`
+	} `json:"data"`
+	Error APIError `json:"error"`
+}
+
+type VideoQueryResponse struct {
+	Data struct {
+		Videos []VideoObject `json:"videos"`
+	} `json:"data"`
+	Error APIError `json:"error"`
+}
+
+type ImportVideosBody struct {
+	// the cursor of a previous import, to continue where it stopped
+	Cursor int64 `json:"cursor"`
+}
+
+type ImportVideosResponse struct {
+	Imported int   `json:"imported"`
+	Cursor   int64 `json:"cursor"`
+	HasMore  bool  `json:"has_more"`
+}
+
+// ====================================
+
+// ListVideos returns a page of the account's videos, newest first. A zero
+// cursor starts at the newest video.
+func ListVideos(ctx context.Context, accessToken string, cursor int64) (*VideoListResponse, *utils.CError) {
+	body := map[string]int64{"max_count": int64(videoPageSize)}
+	if cursor != 0 {
+		body["cursor"] = cursor
+	}
+
+	res := &VideoListResponse{}
+	err := requests.
+		URL("https://open.tiktokapis.com/v2/video/list/").
+		Param("fields", strings.Join(videoFields, ",")).
+		Method(http.MethodPost).
+		Bearer(accessToken).
+		BodyJSON(body).
+		ToJSON(res).
+		AddValidator(nil).
+		Fetch(ctx)
+	if appErr := checkAPIError(err, res.Error); appErr != nil {
+		return nil, appErr
+	}
+	return res, nil
+}
+
+// QueryVideos returns the account's videos with the given ids, at most
+// videoPageSize at once. Ids of deleted or foreign videos are left out.
+func QueryVideos(ctx context.Context, accessToken string, videoIDs []string) (*VideoQueryResponse, *utils.CError) {
+	res := &VideoQueryResponse{}
+	err := requests.
+		URL("https://open.tiktokapis.com/v2/video/query/").
+		Param("fields", strings.Join(videoFields, ",")).
+		Method(http.MethodPost).
+		Bearer(accessToken).
+		BodyJSON(map[string]any{"filters": map[string][]string{"video_ids": videoIDs}}).
+		ToJSON(res).
+		AddValidator(nil).
+		Fetch(ctx)
+	if appErr := checkAPIError(err, res.Error); appErr != nil {
+		return nil, appErr
+	}
+	return res, nil
+}
+
+// ====================================
+
+// handleImportVideos imports the channel's TikTok videos page by page, up
+// to maxImportPages per request. Videos imported before are updated.
+func handleImportVideos(app core.App, ctx echo.Context, env *base.Env) error {
+	// ==========================
+	// get user
+	user := &cmodels.User{}
+	if err := user.GetUserByContext(ctx); err != nil {
+		return ctx.JSON(http.StatusInternalServerError, err)
+	}
+
+	body := &ImportVideosBody{}
+	if err := ctx.Bind(body); err != nil {
+		return ctx.JSON(http.StatusBadRequest, utils.CError{Message: "Invalid request body", Error: err})
+	}
+
+	oauth, status, appErr := findChannelAccess(app, ctx.Request().Context(), env, user.Id, ctx.PathParam("channel_id"))
+	if appErr != nil {
+		return ctx.JSON(status, appErr)
+	}
+
+	response := ImportVideosResponse{Cursor: body.Cursor, HasMore: true}
+	for page := 0; page < maxImportPages && response.HasMore; page++ {
+		res, err := ListVideos(ctx.Request().Context(), oauth.AccessToken, response.Cursor)
+		if err != nil {
+			return ctx.JSON(http.StatusBadGateway, err)
+		}
+		for _, object := range res.Data.Videos {
+			video := &cmodels.Video{}
+			if err := upsertVideo(app, oauth, video, object); err != nil {
+				return ctx.JSON(http.StatusInternalServerError, err)
+			}
+			response.Imported++
+		}
+		response.Cursor = res.Data.Cursor
+		response.HasMore = res.Data.HasMore
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+// RefreshVideo reloads an imported video from TikTok, so a dubjob starts
+// from its current state. A video deleted on TikTok is reported as not
+// found.
+func RefreshVideo(app core.App, ctx context.Context, env *base.Env, video *cmodels.Video) *utils.CError {
+	oauth, _, err := findChannelAccess(app, ctx, env, video.User, video.Channel)
+	if err != nil {
+		return err
+	}
+
+	res, err := QueryVideos(ctx, oauth.AccessToken, []string{video.ExternalID})
+	if err != nil {
+		return err
+	}
+	if len(res.Data.Videos) == 0 {
+		return &utils.CError{Message: "Video not found on TikTok", Error: fmt.Errorf("tiktok video %s: %w", video.ExternalID, sql.ErrNoRows)}
+	}
+	return upsertVideo(app, oauth, video, res.Data.Videos[0])
+}
+
+// upsertVideo stores object on video, which is loaded first when the
+// channel already has it.
+func upsertVideo(app core.App, oauth *cmodels.OAuth, video *cmodels.Video, object VideoObject) *utils.CError {
+	if err := video.FindVideo(app, &cmodels.FindVideoParams{Channel: oauth.Channel, ExternalID: object.ID}); err != nil {
+		if !err.IsNotFound() {
+			return err
+		}
+		video.User = oauth.User
+		video.Channel = oauth.Channel
+		video.ExternalID = object.ID
+	}
+
+	postedIn, errDate := types.ParseDateTime(time.Unix(object.CreateTime, 0))
+	if errDate != nil {
+		postedIn = types.DateTime{}
+	}
+	video.Title = object.Title
+	video.Description = object.VideoDescription
+	video.DurationSec = object.Duration
+	video.CoverImageURL = object.CoverImageURL
+	video.ShareURL = object.ShareURL
+	video.EmbedURL = object.EmbedLink
+	video.ViewCount = object.ViewCount
+	video.PostedIn = postedIn
+	video.SyncedIn = types.NowDateTime()
+	return video.SaveVideo(app)
+}
@@ -1 +1,310 @@
 package tiktok
+
+import (
+	"basedpocket/base"
+	"basedpocket/cmodels"
+	"basedpocket/utils"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// WebhookTolerance is how old a signed webhook may be before it is
+// rejected as a possible replay.
+const WebhookTolerance time.Duration = 5 * time.Minute
+
+const webhookRequestTimeout time.Duration = 30 * time.Second
+
+var ErrInvalidWebhookSignature = errors.New("invalid tiktok webhook signature")
+
+type WebhookEventType string
+
+const AuthorizationRemovedEvent WebhookEventType = "authorization.removed"
+const PostPublishFailedEvent WebhookEventType = "post.publish.failed"
+const PostPublishCompleteEvent WebhookEventType = "post.publish.complete"
+const PostPubliclyAvailableEvent WebhookEventType = "post.publish.publicly_available"
+
+type WebhookEvent struct {
+	ClientKey  string           `json:"client_key"`
+	Event      WebhookEventType `json:"event"`
+	CreateTime int64            `json:"create_time"`
+	UserOpenID string           `json:"user_openid"`
+	// a JSON document of its own, its fields depend on the event
+	Content string `json:"content"`
+}
+
+type WebhookContent struct {
+	PublishID string `json:"publish_id"`
+	// only sent once the post is publicly available
+	PostID string `json:"post_id"`
+	// a number for authorization.removed, a string for post.publish.failed
+	Reason json.RawMessage `json:"reason"`
+}
+
+// ConstructWebhookEvent checks the "TikTok-Signature" header, which has the
+// form "t=<unix>,s=<hex hmac>", against the client secret and parses the
+// payload. The HMAC is a SHA-256 of "<unix>.<payload>".
+func ConstructWebhookEvent(payload []byte, header string, secret string) (*WebhookEvent, *WebhookContent, error) {
+	if secret == "" {
+		return nil, nil, fmt.Errorf("%w: no client secret configured", ErrInvalidWebhookSignature)
+	}
+
+	timestamp := ""
+	signatures := []string{}
+	for _, part := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "s":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return nil, nil, fmt.Errorf("%w: malformed header", ErrInvalidWebhookSignature)
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid timestamp", ErrInvalidWebhookSignature)
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > WebhookTolerance || age < -WebhookTolerance {
+		return nil, nil, fmt.Errorf("%w: timestamp outside of tolerance", ErrInvalidWebhookSignature)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	valid := false
+	for _, signature := range signatures {
+		decoded, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(decoded, expected) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, nil, ErrInvalidWebhookSignature
+	}
+
+	event := &WebhookEvent{}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, nil, err
+	}
+	content := &WebhookContent{}
+	if event.Content != "" {
+		if err := json.Unmarshal([]byte(event.Content), content); err != nil {
+			return nil, nil, err
+		}
+	}
+	return event, content, nil
+}
+
+// ====================================
+
+type webhookHandler func(app core.App, env *base.Env, event *WebhookEvent, content *WebhookContent) *utils.CError
+
+var webhookHandlers = map[WebhookEventType]webhookHandler{
+	AuthorizationRemovedEvent:  handleAuthorizationRemoved,
+	PostPublishFailedEvent:     handlePostPublishFailed,
+	PostPublishCompleteEvent:   handlePostPublishComplete,
+	PostPubliclyAvailableEvent: handlePostPubliclyAvailable,
+}
+
+func handleTiktokWebhook(app core.App, ctx echo.Context, env *base.Env) error {
+	req := ctx.Request()
+	res := ctx.Response()
+
+	const MaxBodyBytes = int64(65536)
+	req.Body = http.MaxBytesReader(res.Writer, req.Body, MaxBodyBytes)
+	payload, err := io.ReadAll(req.Body)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return ctx.String(http.StatusServiceUnavailable, fmt.Errorf("problem with request. eventID: %s", *eventID).Error())
+	}
+	event, content, err := ConstructWebhookEvent(payload, req.Header.Get("TikTok-Signature"), env.TIKTOK_CLIENT_SECRET)
+	if err != nil {
+		eventID := sentry.CaptureException(err)
+		return ctx.String(http.StatusBadRequest, fmt.Errorf("error verifying webhook signature. eventID: %s", *eventID).Error())
+	}
+
+	// other events are acknowledged so TikTok does not keep retrying them
+	handler, ok := webhookHandlers[event.Event]
+	if !ok || event.UserOpenID == "" {
+		res.Writer.WriteHeader(http.StatusOK)
+		return nil
+	}
+	if appErr := handler(app, env, event, content); appErr != nil {
+		return ctx.String(http.StatusInternalServerError, appErr.Message)
+	}
+
+	res.Writer.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// handleAuthorizationRemoved runs when the creator revoked our access on
+// TikTok. Every channel of the account drops its tokens and asks to be
+// reconnected.
+func handleAuthorizationRemoved(app core.App, env *base.Env, event *WebhookEvent, content *WebhookContent) *utils.CError {
+	channels, err := cmodels.FindChannels(app, &cmodels.FindChannelParams{ExternalID: event.UserOpenID})
+	if err != nil {
+		return err
+	}
+
+	for _, channel := range channels {
+		unlock := lockChannel(channel.Id)
+		oauth := &cmodels.OAuth{}
+		err := oauth.FindOAuth(app, &cmodels.FindOAuthParams{Channel: channel.Id})
+		if err == nil {
+			err = oauth.DeleteOAuth(app)
+		}
+		if err != nil && !err.IsNotFound() {
+			unlock()
+			return err
+		}
+		channel.NeedsReauth = true
+		err = channel.SaveChannel(app)
+		unlock()
+		if err != nil {
+			return err
+		}
+
+		cmodels.RecordEvent(app, channel.User, channel.Id, cmodels.WarningStatus, "TikTok access was removed, reconnect the channel to keep publishing")
+	}
+	return nil
+}
+
+// handlePostPublishFailed tells the user about a post that failed. The
+// dubjob of the post is left to the publisher, whose next status check sees
+// the failure and starts the post again or gives up, so the attempts are
+// counted in one place.
+func handlePostPublishFailed(app core.App, env *base.Env, event *WebhookEvent, content *WebhookContent) *utils.CError {
+	channel, _, err := findWebhookPublish(app, event, content)
+	if err != nil || channel == nil {
+		return err
+	}
+
+	message := "A video post to TikTok failed"
+	reason := ""
+	if json.Unmarshal(content.Reason, &reason) == nil && reason != "" {
+		message = fmt.Sprintf("%s: %s", message, reason)
+	}
+	cmodels.RecordEvent(app, channel.User, channel.Id, cmodels.ErrorStatus, message)
+	return nil
+}
+
+// handlePostPublishComplete marks the dubjob of the post as published,
+// the publisher would otherwise only notice on its next status check.
+func handlePostPublishComplete(app core.App, env *base.Env, event *WebhookEvent, content *WebhookContent) *utils.CError {
+	channel, dubjob, err := findWebhookPublish(app, event, content)
+	if err != nil || channel == nil {
+		return err
+	}
+
+	if dubjob != nil {
+		if err := markWebhookPublished(app, env, channel, dubjob, content.PostID); err != nil {
+			return err
+		}
+	}
+
+	cmodels.RecordEvent(app, channel.User, channel.Id, cmodels.SuccessStatus, "A video was published on TikTok")
+	return nil
+}
+
+// handlePostPubliclyAvailable records the post id on the dubjob of the post,
+// TikTok only sends it once the post passed moderation.
+func handlePostPubliclyAvailable(app core.App, env *base.Env, event *WebhookEvent, content *WebhookContent) *utils.CError {
+	channel, dubjob, err := findWebhookPublish(app, event, content)
+	if err != nil || channel == nil || dubjob == nil {
+		return err
+	}
+	return markWebhookPublished(app, env, channel, dubjob, content.PostID)
+}
+
+// markWebhookPublished moves a publishing dubjob to published and records
+// the post id on it. Without a post id in the webhook it is asked from the
+// status endpoint, it is left empty when that fails.
+func markWebhookPublished(app core.App, env *base.Env, channel *cmodels.Channel, dubjob *cmodels.Dubjob, postID string) *utils.CError {
+	if dubjob.Status == cmodels.DubjobPublished {
+		// it only takes a post id it does not have yet
+		if postID == "" || postID == dubjob.PostID {
+			return nil
+		}
+		dubjob.PostID = postID
+		if err := dubjob.SaveDubjob(app); err != nil && !err.IsConflict() {
+			return err
+		}
+		return nil
+	}
+	if dubjob.Status != cmodels.DubjobPublishing {
+		return nil
+	}
+
+	if postID == "" {
+		ctx, cancel := context.WithTimeout(context.Background(), webhookRequestTimeout)
+		if oauth, _, err := findChannelAccess(app, ctx, env, channel.User, channel.Id); err == nil {
+			if res, err := FetchPublishStatus(ctx, oauth.AccessToken, dubjob.PublishID); err == nil && len(res.Data.PubliclyAvailablePostIDs) > 0 {
+				postID = strconv.FormatInt(res.Data.PubliclyAvailablePostIDs[0], 10)
+			}
+		}
+		cancel()
+	}
+
+	// a conflict means the publisher got there first
+	dubjob.PostID = postID
+	dubjob.PublishedIn = types.NowDateTime()
+	if err := dubjob.Transition(app, cmodels.DubjobPublished, "published on tiktok"); err != nil && !err.IsConflict() {
+		return err
+	}
+	return nil
+}
+
+// findWebhookPublish returns the channel of the event's account and the
+// dubjob of the post when it was one of ours. Posts are matched on their
+// publish_id, an event without one comes back without a channel and is
+// acknowledged without an event.
+func findWebhookPublish(app core.App, event *WebhookEvent, content *WebhookContent) (*cmodels.Channel, *cmodels.Dubjob, *utils.CError) {
+	if content.PublishID == "" {
+		return nil, nil, nil
+	}
+
+	channel := &cmodels.Channel{}
+	if err := channel.FindChannel(app, &cmodels.FindChannelParams{ExternalID: event.UserOpenID}); err != nil {
+		if err.IsNotFound() {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	dubjob := &cmodels.Dubjob{}
+	if err := dubjob.FindDubjob(app, &cmodels.FindDubjobParams{PublishID: content.PublishID}); err != nil {
+		if err.IsNotFound() {
+			return channel, nil, nil
+		}
+		return nil, nil, err
+	}
+	// the dubjob's channel, the account may be connected by several users
+	if err := channel.FindChannel(app, &cmodels.FindChannelParams{Id: dubjob.Channel}); err != nil {
+		return nil, nil, err
+	}
+	return channel, dubjob, nil
+}
@@ -0,0 +1,85 @@
+package tiktok
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testClientSecret string = "client_secret_test"
+
+func signWebhook(payload []byte, timestamp time.Time, secret string) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix + "."))
+	mac.Write(payload)
+	return fmt.Sprintf("t=%s,s=%s", unix, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestConstructWebhookEvent(t *testing.T) {
+	payload := []byte(`{"client_key":"key","event":"post.publish.complete","create_time":1,"user_openid":"open_1","content":"{\"publish_id\":\"pub_1\"}"}`)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		payload []byte
+		header  string
+		secret  string
+		valid   bool
+	}{
+		{"valid", payload, signWebhook(payload, now, testClientSecret), testClientSecret, true},
+		{"tampered payload", []byte(`{"event":"post.publish.complete","user_openid":"open_2"}`), signWebhook(payload, now, testClientSecret), testClientSecret, false},
+		{"wrong secret", payload, signWebhook(payload, now, "client_secret_other"), testClientSecret, false},
+		{"stale", payload, signWebhook(payload, now.Add(-WebhookTolerance-time.Minute), testClientSecret), testClientSecret, false},
+		{"from the future", payload, signWebhook(payload, now.Add(WebhookTolerance+time.Minute), testClientSecret), testClientSecret, false},
+		{"malformed header", payload, "s=abc", testClientSecret, false},
+		{"empty secret", payload, signWebhook(payload, now, ""), "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event, content, err := ConstructWebhookEvent(test.payload, test.header, test.secret)
+			if !test.valid {
+				if !errors.Is(err, ErrInvalidWebhookSignature) {
+					t.Fatalf("expected an invalid signature, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if event.Event != PostPublishCompleteEvent || event.UserOpenID != "open_1" || content.PublishID != "pub_1" {
+				t.Fatalf("unexpected event: %+v %+v", event, content)
+			}
+		})
+	}
+}
+
+func TestConstructWebhookEventContent(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		publishID string
+		postID    string
+	}{
+		{"failed post", `{\"publish_id\":\"pub_1\",\"reason\":\"file_format_check_failed\",\"publish_type\":\"DIRECT_PUBLISH\"}`, "pub_1", ""},
+		{"publicly available post", `{\"publish_id\":\"pub_1\",\"post_id\":\"7000000000000000000\",\"publish_type\":\"DIRECT_PUBLISH\"}`, "pub_1", "7000000000000000000"},
+		{"removed authorization", `{\"reason\":1}`, "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := []byte(`{"event":"post.publish.failed","user_openid":"open_1","content":"` + test.content + `"}`)
+			_, content, err := ConstructWebhookEvent(payload, signWebhook(payload, time.Now(), testClientSecret), testClientSecret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content.PublishID != test.publishID || content.PostID != test.postID {
+				t.Fatalf("unexpected content: %+v", content)
+			}
+		})
+	}
+}
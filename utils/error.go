@@ -1,9 +1,26 @@
 package utils
 
-import "github.com/getsentry/sentry-go"
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/getsentry/sentry-go"
+)
 
 type CError struct {
 	Error   error          `json:"-"`
 	Message string         `json:"message"`
 	EventID sentry.EventID `json:"eventID"`
 }
+
+func (e *CError) IsNotFound() bool {
+	return e != nil && errors.Is(e.Error, sql.ErrNoRows)
+}
+
+// ErrConflict marks a write that lost against a concurrent change of the
+// same row.
+var ErrConflict = errors.New("conflict")
+
+func (e *CError) IsConflict() bool {
+	return e != nil && errors.Is(e.Error, ErrConflict)
+}
@@ -50,6 +50,17 @@ func GenerateCSRFState() (string, error) {
 	return hex.EncodeToString(b)[2:], nil
 }
 
+// GeneratePKCEVerifier returns a random PKCE code_verifier of 64 unreserved
+// characters, the spec allows 43 to 128.
+func GeneratePKCEVerifier() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 // ==========================
 
 // func InsertPlatformActivity(app core.App, ctx echo.Context, actParams AcitvityParams) *utils.CError {